@@ -12,19 +12,51 @@ package allhic
 import (
 	"bufio"
 	"bytes"
+	"fmt"
+	"io"
+	"os"
 	"strconv"
 	"strings"
 
-	"github.com/shenwei356/bio/seq"
-	"github.com/shenwei356/bio/seqio/fastx"
 	"github.com/shenwei356/xopen"
 )
 
+// An AGP file describes how the objects (scaffolds or chromosomes) are assembled from
+// the components (contigs) and the gaps between them, following the AGP v2.1 spec:
+// https://www.ncbi.nlm.nih.gov/assembly/agp/AGP_Specification/
+//
+// ##agp-version	2.1
+// object	object_beg	object_end	part_number	W	component_id	component_beg	component_end	orientation
+// object	object_beg	object_end	part_number	N	gap_length	gap_type	linkage	linkage_evidence
+
 const (
 	// LineWidth specifies how many bases to show per line
 	LineWidth = 60
 	// LargeSequence will notify the writer to send a notification
 	LargeSequence = 1000000
+	// AGPVersion is the version of the AGP spec that we read and write
+	AGPVersion = "2.1"
+	// agpColumns is the number of tab-separated columns in an AGP line
+	agpColumns = 9
+)
+
+var (
+	// agpComponentTypes are the valid values in column 5, N and U are gaps
+	agpComponentTypes = "ADFGOPWNU"
+	// agpGapTypes are the valid values in column 7 of a gap
+	agpGapTypes = map[string]bool{
+		"scaffold": true, "contig": true, "centromere": true, "short_arm": true,
+		"heterochromatin": true, "telomere": true, "repeat": true, "contamination": true,
+	}
+	// agpLinkageEvidence are the valid values in column 9 of a gap, separated by ;
+	agpLinkageEvidence = map[string]bool{
+		"na": true, "paired-ends": true, "align_genus": true, "align_xgenus": true,
+		"align_trnscpt": true, "within_clone": true, "clone_contig": true, "map": true,
+		"pcr": true, "proximity_ligation": true, "strobe": true, "unspecified": true,
+	}
+	// agpOrientations are the valid values in column 9 of a component, 0 is the
+	// deprecated form of ?
+	agpOrientations = map[string]bool{"+": true, "-": true, "?": true, "0": true, "na": true}
 )
 
 // AGPLine is a line in the AGP file
@@ -35,99 +67,377 @@ type AGPLine struct {
 	partNumber    int
 	componentType byte
 	isGap         bool
-	strand        byte
+	orientation   string
 	// As a gap
 	gapLength       int
 	gapType         string
 	linkage         string
-	linkageEvidence string
+	linkageEvidence []string
 	// As a sequence chunk
 	componentID  string
 	componentBeg int
 	componentEnd int
+	// Comment lines right before this line, without the leading #
+	comments []string
+	lineNo   int
 }
 
 // AGP is a collection of AGPLines
 type AGP struct {
-	lines []AGPLine
+	lines    []AGPLine
+	comments []string // Comment lines after the last line
 }
 
-// Add adds an AGPLine to the collection
-func (r *AGP) Add(row string) {
-	words := strings.Fields(row)
+// parseAGPLine parses the columns of an AGP line, the values are checked in Validate
+func parseAGPLine(row string) (AGPLine, error) {
 	var line AGPLine
+	words := strings.Split(row, "\t")
+	if len(words) != agpColumns {
+		return line, fmt.Errorf("expected %d tab-separated columns, got %d", agpColumns, len(words))
+	}
+	var err error // First column that is not an integer
+	atoi := func(column int, name string) int {
+		v, e := strconv.Atoi(words[column])
+		if e != nil && err == nil {
+			err = fmt.Errorf("invalid %s `%s`", name, words[column])
+		}
+		return v
+	}
 	line.object = words[0]
-	line.objectBeg, _ = strconv.Atoi(words[1])
-	line.objectEnd, _ = strconv.Atoi(words[2])
-	line.partNumber, _ = strconv.Atoi(words[3])
+	line.objectBeg = atoi(1, "object_beg")
+	line.objectEnd = atoi(2, "object_end")
+	line.partNumber = atoi(3, "part_number")
+	if len(words[4]) != 1 || !strings.Contains(agpComponentTypes, words[4]) {
+		return line, fmt.Errorf("invalid component_type `%s`", words[4])
+	}
 	line.componentType = words[4][0]
 	line.isGap = line.componentType == 'N' || line.componentType == 'U'
 	if line.isGap {
-		line.gapLength, _ = strconv.Atoi(words[5])
+		line.gapLength = atoi(5, "gap_length")
 		line.gapType = words[6]
 		line.linkage = words[7]
-		line.linkageEvidence = words[8]
+		line.linkageEvidence = strings.Split(words[8], ";")
 	} else {
 		line.componentID = words[5]
-		line.componentBeg, _ = strconv.Atoi(words[6])
-		line.componentEnd, _ = strconv.Atoi(words[7])
-		line.strand = words[8][0]
+		line.componentBeg = atoi(6, "component_beg")
+		line.componentEnd = atoi(7, "component_end")
+		line.orientation = words[8]
 	}
-	r.lines = append(r.lines, line)
+	return line, err
 }
 
-// buildFasta builds target FASTA based on info from agpfile
-func buildFasta(agpfile string, seqs map[string]*seq.Seq) {
-	log.Noticef("Parse agpfile `%s`", agpfile)
-	file := mustOpen(agpfile)
+// Add adds an AGPLine to the collection, the rows that cannot be parsed are skipped
+// with a warning, see ParseAGP to stop at the errors instead
+func (r *AGP) Add(row string) {
+	line, err := parseAGPLine(row)
+	if err != nil {
+		log.Warningf("Skip AGP line `%s`: %v", row, err)
+		return
+	}
+	line.lineNo = len(r.lines) + 1
+	r.lines = append(r.lines, line)
+}
 
+// ParseAGP reads all the lines of an AGP file, and stops at the first line that
+// cannot be parsed. Comment lines are kept in place.
+func ParseAGP(reader io.Reader) (*AGP, error) {
 	agp := new(AGP)
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(reader)
+	lineNo := 0
 	for scanner.Scan() {
-		agp.Add(scanner.Text())
+		lineNo++
+		row := strings.TrimRight(scanner.Text(), "\r")
+		if strings.HasPrefix(row, "#") {
+			agp.comments = append(agp.comments, row[1:])
+			continue
+		}
+		if strings.TrimSpace(row) == "" {
+			return agp, fmt.Errorf("line %d: blank lines are not allowed", lineNo)
+		}
+		line, err := parseAGPLine(row)
+		if err != nil {
+			return agp, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		line.lineNo = lineNo
+		line.comments, agp.comments = agp.comments, nil
+		agp.lines = append(agp.lines, line)
+	}
+	return agp, scanner.Err()
+}
+
+// ReadAGPFile parses the AGP file, which may be gzipped
+func ReadAGPFile(filename string) (*AGP, error) {
+	log.Noticef("Parse agpfile `%s`", filename)
+	f, err := xopen.Ropen(filename)
+	if err != nil {
+		return nil, err
 	}
+	defer f.Close()
+	return ParseAGP(f)
+}
 
-	var buf bytes.Buffer
-	outFile := RemoveExt(agpfile) + ".fasta"
-	outfh, _ := xopen.Wopen(outFile)
-	prevObject := ""
-	for _, line := range agp.lines {
-		if line.object != prevObject {
-			if prevObject != "" {
-				writeRecord(prevObject, buf, outfh)
+// Validate checks the AGP against the spec, and the component ranges against the
+// sequence sizes if sizes is not nil. All the problems are returned, in the order of
+// the lines.
+func (r *AGP) Validate(sizes map[string]int) []error {
+	var errs []error
+	report := func(line AGPLine, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("line %d: %s", line.lineNo, fmt.Sprintf(format, args...)))
+	}
+	seen := make(map[string]bool)       // Objects seen so far
+	ranges := make(map[string][][2]int) // Ranges of each component used so far
+	var prev AGPLine
+	for i, line := range r.lines {
+		if line.object != prev.object || i == 0 {
+			if i > 0 && prev.isGap {
+				report(prev, "object %s ends with a gap", prev.object)
+			}
+			if seen[line.object] {
+				report(line, "lines of object %s are not contiguous", line.object)
+			}
+			seen[line.object] = true
+			if line.objectBeg != 1 {
+				report(line, "object_beg of the first line of %s is %d, expected 1",
+					line.object, line.objectBeg)
+			}
+			if line.partNumber != 1 {
+				report(line, "part_number of the first line of %s is %d, expected 1",
+					line.object, line.partNumber)
+			}
+			if line.isGap {
+				report(line, "object %s starts with a gap", line.object)
+			}
+		} else {
+			if line.objectBeg != prev.objectEnd+1 {
+				report(line, "object_beg is %d, expected %d after the previous line",
+					line.objectBeg, prev.objectEnd+1)
+			}
+			if line.partNumber != prev.partNumber+1 {
+				report(line, "part_number is %d, expected %d", line.partNumber, prev.partNumber+1)
+			}
+			if line.isGap && prev.isGap {
+				report(line, "gap right after another gap")
 			}
-			prevObject = line.object
-			buf.Reset()
 		}
+		if line.objectEnd < line.objectBeg {
+			report(line, "object_end %d is before object_beg %d", line.objectEnd, line.objectBeg)
+		}
+		span := line.objectEnd - line.objectBeg + 1
 		if line.isGap {
-			buf.Write(bytes.Repeat([]byte("N"), line.gapLength))
+			r.validateGap(line, span, report)
 		} else {
-			if s, ok := seqs[line.componentID]; ok {
-				// fmt.Printf("name: %s seq: %s\n", line.componentID, s.SubSeq(1, 10))
-				s = s.SubSeq(line.componentBeg, line.componentEnd)
-				if line.strand == '-' {
-					s.RevComInplace()
-				}
-				buf.Write(s.Seq)
-			} else {
-				log.Errorf("Cannot locate %s", line.componentID)
+			r.validateComponent(line, span, sizes, ranges, report)
+		}
+		prev = line
+	}
+	if prev.isGap {
+		report(prev, "object %s ends with a gap", prev.object)
+	}
+	return errs
+}
+
+// validateGap checks the gap columns
+func (r *AGP) validateGap(line AGPLine, span int,
+	report func(AGPLine, string, ...interface{})) {
+	if line.gapLength < 1 {
+		report(line, "gap_length must be positive, got %d", line.gapLength)
+	} else if line.gapLength != span {
+		report(line, "gap_length %d differs from the object range of %d bp", line.gapLength, span)
+	} else if line.componentType == 'U' && line.gapLength != DefaultGapSize {
+		report(line, "U gap must have gap_length %d, got %d", DefaultGapSize, line.gapLength)
+	}
+	if !agpGapTypes[line.gapType] {
+		report(line, "invalid gap_type `%s`", line.gapType)
+	}
+	switch line.linkage {
+	case "yes":
+		for _, evidence := range line.linkageEvidence {
+			if evidence == "na" {
+				report(line, "linked gap must have linkage_evidence other than na")
+			} else if !agpLinkageEvidence[evidence] {
+				report(line, "invalid linkage_evidence `%s`", evidence)
 			}
 		}
+	case "no":
+		if line.gapType == "scaffold" {
+			report(line, "scaffold gap must have linkage yes")
+		}
+		if strings.Join(line.linkageEvidence, ";") != "na" {
+			report(line, "unlinked gap must have linkage_evidence na, got `%s`",
+				strings.Join(line.linkageEvidence, ";"))
+		}
+	default:
+		report(line, "linkage must be yes or no, got `%s`", line.linkage)
+	}
+	if line.gapType == "contig" && line.linkage == "yes" {
+		report(line, "contig gap must have linkage no")
 	}
-	// Last one
-	writeRecord(prevObject, buf, outfh)
-	buf.Reset()
-	log.Noticef("Assembly FASTA file `%s` built", outFile)
 }
 
-// writeRecord writes the FASTA record to the file
-func writeRecord(object string, buf bytes.Buffer, outfh *xopen.Writer) {
-	record, _ := fastx.NewRecordWithoutValidation(seq.DNA, []byte{}, []byte(object),
-		[]byte{}, buf.Bytes())
-	size := record.Seq.Length()
-	if size > LargeSequence {
-		log.Noticef("Write sequence %s (size = %d bp)", record.Name, size)
+// validateComponent checks the component columns, and that the component range is
+// within the sequence and does not overlap with another use of the same component
+func (r *AGP) validateComponent(line AGPLine, span int, sizes map[string]int,
+	ranges map[string][][2]int, report func(AGPLine, string, ...interface{})) {
+	if line.componentBeg < 1 || line.componentEnd < line.componentBeg {
+		report(line, "invalid component range %d-%d", line.componentBeg, line.componentEnd)
+		return
 	}
-	record.FormatToWriter(outfh, LineWidth)
-	outfh.Flush()
+	if line.componentEnd-line.componentBeg+1 != span {
+		report(line, "component range of %d bp differs from the object range of %d bp",
+			line.componentEnd-line.componentBeg+1, span)
+	}
+	if !agpOrientations[line.orientation] {
+		report(line, "invalid orientation `%s`", line.orientation)
+	}
+	if sizes != nil {
+		if size, ok := sizes[line.componentID]; !ok {
+			report(line, "component %s not found", line.componentID)
+		} else if line.componentEnd > size {
+			report(line, "component_end %d is beyond the end of %s (%d bp)",
+				line.componentEnd, line.componentID, size)
+		}
+	}
+	for _, used := range ranges[line.componentID] {
+		if line.componentBeg <= used[1] && used[0] <= line.componentEnd {
+			report(line, "component %s range %d-%d overlaps with %d-%d used before",
+				line.componentID, line.componentBeg, line.componentEnd, used[0], used[1])
+		}
+	}
+	ranges[line.componentID] = append(ranges[line.componentID],
+		[2]int{line.componentBeg, line.componentEnd})
+}
+
+// nGaps counts the gap lines
+func (r *AGP) nGaps() int {
+	gaps := 0
+	for _, line := range r.lines {
+		if line.isGap {
+			gaps++
+		}
+	}
+	return gaps
+}
+
+// String formats the AGPLine as tab-separated columns
+func (r AGPLine) String() string {
+	if r.isGap {
+		return fmt.Sprintf("%s\t%d\t%d\t%d\t%c\t%d\t%s\t%s\t%s",
+			r.object, r.objectBeg, r.objectEnd, r.partNumber, r.componentType,
+			r.gapLength, r.gapType, r.linkage, strings.Join(r.linkageEvidence, ";"))
+	}
+	return fmt.Sprintf("%s\t%d\t%d\t%d\t%c\t%s\t%d\t%d\t%s",
+		r.object, r.objectBeg, r.objectEnd, r.partNumber, r.componentType,
+		r.componentID, r.componentBeg, r.componentEnd, r.orientation)
+}
+
+// Write writes all the lines with their comments, ParseAGP reads them back
+func (r *AGP) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	writeComments := func(comments []string) error {
+		for _, comment := range comments {
+			if _, err := fmt.Fprintf(bw, "#%s\n", comment); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, line := range r.lines {
+		if err := writeComments(line.comments); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(bw, line); err != nil {
+			return err
+		}
+	}
+	if err := writeComments(r.comments); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// WriteFile writes the AGP file to disk
+func (r *AGP) WriteFile(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := r.Write(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// mustValidate logs all the problems in the AGP and aborts if there are any
+func (r *AGP) mustValidate(agpfile string, sizes map[string]int) {
+	errs := r.Validate(sizes)
+	for _, err := range errs {
+		log.Errorf("%s", err)
+	}
+	if len(errs) > 0 {
+		ErrorAbort(fmt.Errorf("%d problems found in `%s`", len(errs), agpfile))
+	}
+}
+
+// AGPValidator checks an AGP file before submission
+type AGPValidator struct {
+	AGPfile   string
+	Fastafile string // Check the component ranges against the sequences if set
+}
+
+// Run validates the AGP file and exits with an error if there are problems
+func (r *AGPValidator) Run() {
+	agp, err := ReadAGPFile(r.AGPfile)
+	ErrorAbort(err)
+	var sizes map[string]int
+	if r.Fastafile != "" {
+		src, err := openContigSource(r.Fastafile)
+		ErrorAbort(err)
+		sizes = contigSizes(src)
+		_ = src.Close()
+	}
+	agp.mustValidate(r.AGPfile, sizes)
+	objects, gaps := 0, agp.nGaps()
+	for i, line := range agp.lines {
+		if i == 0 || line.object != agp.lines[i-1].object {
+			objects++
+		}
+	}
+	log.Noticef("`%s` is valid AGP %s: %d objects, %d components and %d gaps",
+		r.AGPfile, AGPVersion, objects, len(agp.lines)-gaps, gaps)
+}
+
+// buildFasta builds target FASTA based on info from agp. Components can be sub-ranges
+// of the contigs, e.g. when a contig is split during curation. Each component is
+// fetched and written on its own, so only one is in memory at a time.
+func buildFasta(agp *AGP, outFile string, src contigSource) {
+	outfh, err := xopen.Wopen(outFile)
+	ErrorAbort(err)
+	w := &fastaWriter{w: outfh}
+	gap := bytes.Repeat([]byte("N"), LineWidth*1000)
+	prevObject := ""
+	for _, line := range agp.lines {
+		if line.object != prevObject {
+			w.start(line.object)
+			prevObject = line.object
+		}
+		if line.isGap {
+			for n := line.gapLength; n > 0; n -= len(gap) {
+				w.write(gap[:min(n, len(gap))])
+			}
+			continue
+		}
+		s, err := src.fetch(line.componentID, line.componentBeg, line.componentEnd)
+		if err != nil {
+			log.Errorf("Cannot locate %s: %v", line.componentID, err)
+			continue
+		}
+		if line.orientation == "-" {
+			reverseComplement(s)
+		}
+		w.write(s)
+	}
+	w.finish()
+	ErrorAbort(outfh.Close())
+	log.Noticef("Assembly FASTA file `%s` built", outFile)
 }
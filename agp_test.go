@@ -0,0 +1,118 @@
+/*
+ *  agp_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/18/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+const testAGP = `##agp-version	2.1
+# Curated by hand
+g1	1	100	1	W	tig0001	1	100	+
+g1	101	200	2	U	100	scaffold	yes	proximity_ligation;map
+g1	201	250	3	W	tig0002	51	100	-
+# Split off the first half of tig0002
+g2	1	50	1	W	tig0002	1	50	?
+g2	51	60	2	N	10	contig	no	na
+g2	61	90	3	W	tig0003	1	30	+
+#end
+`
+
+func TestParseAGP(t *testing.T) {
+	agp, err := allhic.ParseAGP(strings.NewReader(testAGP))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizes := map[string]int{"tig0001": 100, "tig0002": 100, "tig0003": 30}
+	if errs := agp.Validate(sizes); len(errs) > 0 {
+		t.Fatalf("Expected a valid AGP, got %v", errs)
+	}
+
+	// Writing gives back the same file, including the comments
+	var buf bytes.Buffer
+	if err := agp.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != testAGP {
+		t.Fatalf("Round trip changed the AGP:\n%s\nvs\n%s", buf.String(), testAGP)
+	}
+
+	for _, row := range []string{
+		"g1 1 100 1 W tig0001 1 100 +",         // Not tab-separated
+		"g1\t1\tx\t1\tW\ttig0001\t1\t100\t+",   // object_end not integer
+		"g1\t1\t100\t1\tX\ttig0001\t1\t100\t+", // Unknown component_type
+		"",
+	} {
+		if _, err := allhic.ParseAGP(strings.NewReader(row + "\n")); err == nil {
+			t.Fatalf("Expected a parse error for %q", row)
+		}
+	}
+}
+
+func TestAGPAdd(t *testing.T) {
+	agp := new(allhic.AGP)
+	var expected strings.Builder
+	for _, row := range strings.Split(strings.TrimSpace(testAGP), "\n") {
+		if !strings.HasPrefix(row, "#") {
+			agp.Add(row)
+			expected.WriteString(row + "\n")
+		}
+	}
+	agp.Add("g1 1 100 1 W tig0001 1 100 +") // Skipped
+	sizes := map[string]int{"tig0001": 100, "tig0002": 100, "tig0003": 30}
+	if errs := agp.Validate(sizes); len(errs) > 0 {
+		t.Fatalf("Expected a valid AGP, got %v", errs)
+	}
+	var buf bytes.Buffer
+	if err := agp.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expected.String() {
+		t.Fatalf("Expected the added lines:\n%s\ngot\n%s", expected.String(), buf.String())
+	}
+}
+
+func TestValidateAGP(t *testing.T) {
+	sizes := map[string]int{"tig0001": 100, "tig0002": 100}
+	for agp, problem := range map[string]string{
+		"g1\t2\t101\t1\tW\ttig0001\t1\t100\t+\n":                                              "expected 1",
+		"g1\t1\t100\t1\tW\ttig0001\t1\t100\t+\ng1\t102\t201\t2\tW\ttig0002\t1\t100\t+\n":      "expected 101",
+		"g1\t1\t100\t1\tW\ttig0001\t1\t100\t+\ng1\t101\t200\t3\tW\ttig0002\t1\t100\t+\n":      "part_number is 3",
+		"g1\t1\t100\t1\tW\ttig0001\t1\t100\t+\ng1\t101\t200\t2\tU\t100\tscaffold\tyes\tmap\n": "ends with a gap",
+		"g1\t1\t100\t1\tW\ttig0001\t1\t100\t+\ng1\t101\t200\t2\tN\t100\tgapped\tyes\tmap\n":   "gap_type",
+		"g1\t1\t10\t1\tW\ttig0001\t1\t100\t+\n":                                               "differs from the object range",
+		"g1\t1\t101\t1\tW\ttig0001\t1\t101\t+\n":                                              "beyond the end",
+		"g1\t1\t100\t1\tW\ttig0009\t1\t100\t+\n":                                              "not found",
+		"g1\t1\t100\t1\tW\ttig0001\t1\t100\tup\n":                                             "orientation",
+		"g1\t1\t60\t1\tW\ttig0001\t1\t60\t+\ng2\t1\t60\t1\tW\ttig0001\t41\t100\t-\n":          "overlaps",
+		"g1\t1\t100\t1\tW\ttig0001\t1\t100\t+\ng2\t1\t100\t1\tW\ttig0002\t1\t100\t+\n" +
+			"g1\t1\t100\t1\tW\ttig0002\t1\t100\t+\n": "not contiguous",
+		"g1\t1\t100\t1\tW\ttig0001\t1\t100\t+\ng1\t101\t200\t2\tN\t100\tscaffold\tno\tna\n" +
+			"g1\t201\t300\t3\tW\ttig0002\t1\t100\t+\n": "linkage yes",
+		"g1\t1\t100\t1\tW\ttig0001\t1\t100\t+\ng1\t101\t150\t2\tU\t50\tscaffold\tyes\tmap\n" +
+			"g1\t151\t250\t3\tW\ttig0002\t1\t100\t+\n": "U gap must have gap_length 100",
+	} {
+		parsed, err := allhic.ParseAGP(strings.NewReader(agp))
+		if err != nil {
+			t.Fatal(err)
+		}
+		errs := parsed.Validate(sizes)
+		found := false
+		for _, err := range errs {
+			found = found || strings.Contains(err.Error(), problem)
+		}
+		if !found {
+			t.Fatalf("Expected a problem with %q in\n%s\ngot %v", problem, agp, errs)
+		}
+	}
+}
@@ -13,7 +13,6 @@ import (
 	"fmt"
 	"github.com/spf13/cobra"
 	"path"
-	"sort"
 	"strconv"
 	"strings"
 )
@@ -155,10 +154,11 @@ can be generated with the "extract" sub-command.
 	partitionCmd.Flags().IntVarP(&maxLinkDensity, "maxLinkDensity", "", MaxLinkDensity, "Density threshold before marking contig as repetitive (CLUSTER_MAX_LINK_DENSITY in LACHESIS)")
 	partitionCmd.Flags().IntVarP(&nonInformativeRatio, "nonInformativeRatio", "", NonInformativeRatio, "cutoff for recovering skipped contigs back into the clusters (CLUSTER_NON-INFORMATIVE_RATIO in LACHESIS)")
 
-	var skipGA, resume bool
+	var skipGA, resume, parallel bool
 	var seed int64
-	var npop, ngen int
-	var mutpb float64
+	var npop, ngen, minSize, limit, nContestants, maxGen, nIslands, migFrequency, nMigrants, nStarts, exactSize int
+	var mutpb, crosspb float64
+	var score, distfile, crossover, method, orientInit, orientSearch string
 	optimizeCmd := &cobra.Command{
 		Use:   "optimize counts_RE.txt clmfile",
 		Short: "Order-and-orient tigs in a group",
@@ -178,42 +178,153 @@ on a cluster).
 			clmfile := args[1]
 			p := Optimizer{REfile: refile, Clmfile: clmfile,
 				RunGA: !skipGA, Resume: resume,
-				Seed: seed, NPop: npop, NGen: ngen, MutProb: mutpb}
+				Seed: seed, NPop: npop, NGen: ngen, MutProb: mutpb, CrossProb: crosspb,
+				MinSize: minSize, Limit: limit, NContestants: nContestants, MaxGen: maxGen,
+				NIslands: nIslands, MigFrequency: migFrequency, NMigrants: nMigrants,
+				Score: score, Distfile: distfile, Crossover: crossover, Method: method,
+				NStarts: nStarts, Parallel: parallel, ExactSize: exactSize,
+				OrientInit: orientInit, OrientSearch: orientSearch}
 			p.Run()
 		},
 	}
-	optimizeCmd.Flags().BoolVarP(&skipGA, "skipGA", "", false, "Skip GA step")
+	optimizeCmd.Flags().BoolVarP(&skipGA, "skipGA", "", false, "Skip GA step (or the ordering --method)")
+	optimizeCmd.Flags().StringVarP(&method, "method", "", MethodGA, "Ordering optimizer, one of ga, sa, 2opt, oropt, memetic, exact")
 	optimizeCmd.Flags().BoolVarP(&resume, "resume", "", false, "Resume from existing tour file")
 	optimizeCmd.Flags().Int64VarP(&seed, "seed", "", Seed, "Random seed")
+	optimizeCmd.Flags().IntVarP(&nStarts, "starts", "", NStarts, "Number of seeds to try, the best tour is kept and the adjacency support is reported")
+	optimizeCmd.Flags().BoolVarP(&parallel, "parallel", "", false, "Run the starts in parallel")
 	optimizeCmd.Flags().IntVarP(&npop, "npop", "", Npop, "Population size")
 	optimizeCmd.Flags().IntVarP(&ngen, "ngen", "", Ngen, "Number of generations for convergence")
 	optimizeCmd.Flags().Float64VarP(&mutpb, "mutapb", "", MutaProb, "Mutation prob in GA")
+	optimizeCmd.Flags().Float64VarP(&crosspb, "crosspb", "", CrossoverProb, "Crossover prob in GA")
+	optimizeCmd.Flags().StringVarP(&crossover, "crossover", "", CrossoverOX, "Crossover operator in GA, one of ox, pmx, erx")
+	optimizeCmd.Flags().IntVarP(&minSize, "minsize", "", 0, "Tigs smaller than this are left out of the tour, 0 keeps all")
+	optimizeCmd.Flags().IntVarP(&limit, "limit", "", LIMIT, "Largest distance for two tigs to add to total score")
+	optimizeCmd.Flags().IntVarP(&nContestants, "ncontestants", "", NContestants, "Tournament size in GA selection")
+	optimizeCmd.Flags().IntVarP(&maxGen, "maxgen", "", MaxGen, "Hard cap on the number of generations in GA")
+	optimizeCmd.Flags().IntVarP(&nIslands, "islands", "", NIslands, "Number of populations evolved in parallel in GA")
+	optimizeCmd.Flags().IntVarP(&migFrequency, "migfreq", "", MigFrequency, "Number of generations between migrations of the best tours across islands")
+	optimizeCmd.Flags().IntVarP(&nMigrants, "migrants", "", NMigrants, "Number of best tours sent to the next island in a migration")
+	optimizeCmd.Flags().IntVarP(&exactSize, "exactsize", "", 0, "Groups with at most this many tigs are solved exactly (proven optimum, or refined by --method if not proven), 0 to skip")
+	optimizeCmd.Flags().StringVarP(&orientInit, "orientinit", "", OrientEigen, "Initial orientations, one of eigen, gw")
+	optimizeCmd.Flags().StringVarP(&orientSearch, "orientsearch", "", OrientOne, "Refinement of orientations, one of one, kl")
+	optimizeCmd.Flags().StringVarP(&score, "score", "", ScoreRecip, "Score to evaluate tours, one of recip, sumlog, likelihood, ml")
+	optimizeCmd.Flags().StringVarP(&distfile, "distribution", "", "", "Link size distribution from extract for likelihood score (default: clmfile prefix + .distribution.txt)")
 
+	var buildClmfile, buildDistfile, buildAGPfile string
+	var separateUnplaced bool
+	var buildOrder, buildMapfile, buildReffile string
+	var writeChain, writeGFA bool
 	buildCmd := &cobra.Command{
 		Use:   "build tourfile1 tourfile2 ... contigs.fasta asm.chr.fasta",
 		Short: "Build genome release",
 		Long: `
 Build function:
 Convert the tourfile into the standard AGP file, which is then converted
-into a FASTA genome release.
+into a FASTA genome release. Contigs not in any tour are added as their own
+objects, or written separately with --unplaced. The groups are named g1, g2,
+... in the natural order of the tour files, or by --order, --mapping or
+--reference, where the PAF of the contigs on the reference is from:
+
+$ minimap2 -x asm5 reference.fasta contigs.fasta > contigs.paf
+
+After manual curation, the FASTA can be built from the curated AGP instead of
+the tours, where the components may be parts of split contigs:
+
+$ allhic build --agp curated.agp contigs.fasta asm.chr.fasta
+
+The contigs are read one at a time with the .fai index, and the .gzi index if
+contigs.fasta is bgzipped, to keep the memory low for large genomes:
+
+$ bgzip -i contigs.fasta && samtools faidx contigs.fasta.gz
 `,
-		Args: cobra.MinimumNArgs(3),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if buildAGPfile != "" {
+				return cobra.ExactArgs(2)(cmd, args)
+			}
+			return cobra.MinimumNArgs(3)(cmd, args)
+		},
 		Run: func(cmd *cobra.Command, args []string) {
 
 			tourfiles := make([]string, 0)
 			for i := 0; i < len(args)-2; i++ {
 				tourfiles = append(tourfiles, args[i])
 			}
-			sort.Strings(tourfiles)
 
 			fastafile := args[len(args)-2]
 			outfastafile := args[len(args)-1]
 			p := Builder{Tourfiles: tourfiles,
-				Fastafile:    fastafile,
-				OutFastafile: outfastafile}
+				Fastafile:        fastafile,
+				Clmfile:          buildClmfile,
+				Distfile:         buildDistfile,
+				AGPfile:          buildAGPfile,
+				SeparateUnplaced: separateUnplaced,
+				Order:            buildOrder,
+				Mapfile:          buildMapfile,
+				Reffile:          buildReffile,
+				WriteChain:       writeChain,
+				WriteGFA:         writeGFA,
+				OutFastafile:     outfastafile}
+			p.Run()
+		},
+	}
+	buildCmd.Flags().StringVarP(&buildClmfile, "clm", "", "", "Estimate gap sizes from the link distances in this clmfile, instead of 100-bp gaps")
+	buildCmd.Flags().StringVarP(&buildAGPfile, "agp", "", "", "Build the FASTA from this curated AGP, skipping the tours")
+	buildCmd.Flags().StringVarP(&buildOrder, "order", "", OrderNatural, "Order of the groups, one of input, natural (by the tour file names), length")
+	buildCmd.Flags().StringVarP(&buildMapfile, "mapping", "", "", "Two-column file of the groups (tour files or g1, g2, ...) and their names, in the output order")
+	buildCmd.Flags().StringVarP(&buildReffile, "reference", "", "", "PAF of the contigs aligned to a reference, to name and orient the groups after the best-matching chromosomes")
+	buildCmd.Flags().BoolVarP(&writeChain, "chain", "", false, "Also write a UCSC chain file from the contigs to the objects")
+	buildCmd.Flags().BoolVarP(&writeGFA, "gfa", "", false, "Also write a GFA 1.0 graph of the oriented contigs with the gap sizes")
+	buildCmd.Flags().BoolVarP(&separateUnplaced, "unplaced", "", false, "Write the contigs not in any tour to a separate .unplaced.fasta")
+	buildCmd.Flags().StringVarP(&buildDistfile, "distribution", "", "", "Link size distribution from extract for gap sizes (default: clmfile prefix + .distribution.txt)")
+
+	agpCmd := &cobra.Command{
+		Use:   "agp",
+		Short: "Utilities for AGP files",
+	}
+	agpValidateCmd := &cobra.Command{
+		Use:   "validate agpfile [contigs.fasta]",
+		Short: "Check an AGP file against the AGP v2.1 spec",
+		Long: `
+AGP validate function:
+Check the AGP file, typically after manual curation, before submission. Besides
+the columns, object coordinates must be continuous, part numbers consecutive,
+and objects cannot start or end with gaps. If contigs.fasta is given, the
+component ranges are checked against the sequence sizes.
+`,
+		Args: cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			p := AGPValidator{AGPfile: args[0]}
+			if len(args) > 1 {
+				p.Fastafile = args[1]
+			}
+			p.Run()
+		},
+	}
+	agpCmd.AddCommand(agpValidateCmd)
+
+	var liftFormat string
+	var liftReverse bool
+	liftoverCmd := &cobra.Command{
+		Use:   "liftover agpfile infile outfile",
+		Short: "Lift BED, GFF3 or VCF between contig and AGP object coordinates",
+		Long: `
+Liftover function:
+Convert the coordinates of the records in a BED, GFF3 or VCF file from the
+contigs to the objects in the AGP, typically from build, or back to the contigs
+with --reverse. Records on '-' components are flipped to the other strand, and
+the VCF alleles are reverse complemented. Records that cannot be lifted, e.g.
+those that span a gap, are written to outfile prefix + .unmapped with the reason.
+`,
+		Args: cobra.ExactArgs(3),
+		Run: func(cmd *cobra.Command, args []string) {
+			p := Lifter{AGPfile: args[0], Infile: args[1], Outfile: args[2],
+				Format: liftFormat, Reverse: liftReverse}
 			p.Run()
 		},
 	}
+	liftoverCmd.Flags().StringVarP(&liftFormat, "format", "", "", "Format of infile, one of bed, gff3, vcf (default: from the extension)")
+	liftoverCmd.Flags().BoolVarP(&liftReverse, "reverse", "", false, "Lift from the objects back to the contigs")
 
 	plotCmd := &cobra.Command{
 		Use:   "plot bamfile tourfile",
@@ -233,23 +344,39 @@ Given a bamfile, we extract matrix of link counts and plot heatmap.
 		},
 	}
 
+	var assessAGP bool
 	assessCmd := &cobra.Command{
-		Use:   "assess bamfile bedfile chr1",
+		Use:   "assess bamfile bedfile|agpfile [chr1]",
 		Short: "Assess the orientations of contigs",
 		Long: `
 Assess function:
 Compute the posterior probability of contig orientations after scaffolding
-as a quality assessment step.
+as a quality assessment step. All the sequences in the bedfile are assessed in
+one pass of the bamfile and written to one table, unless a sequence is given.
+The contigs are either in a bedfile, or with --agp taken from the AGP written by
+build, with the reads in the bamfile mapped to the built sequences.
 `,
-		Args: cobra.ExactArgs(3),
+		Args: cobra.RangeArgs(2, 3),
 		Run: func(cmd *cobra.Command, args []string) {
 			bamfile := args[0]
 			bedfile := args[1]
-			seqid := args[2]
-			p := Assesser{Bamfile: bamfile, Bedfile: bedfile, Seqid: seqid}
+			seqid := ""
+			if len(args) > 2 {
+				seqid = args[2]
+			}
+			p := Assesser{Bamfile: bamfile, Seqid: seqid}
+			if assessAGP {
+				p.AGPfile = bedfile
+			} else {
+				if strings.Contains(strings.ToLower(bedfile), ".agp") {
+					log.Warningf("`%s` is read as a bedfile, use --agp for an AGP", bedfile)
+				}
+				p.Bedfile = bedfile
+			}
 			p.Run()
 		},
 	}
+	assessCmd.Flags().BoolVarP(&assessAGP, "agp", "", false, "Take the contigs from an AGP instead of a bedfile")
 
 	pipelineCmd := &cobra.Command{
 		Use:   "pipeline bamfile fastafile k",
@@ -287,7 +414,12 @@ A convenience driver function. Chain the following steps sequentially.
 				optimizer := Optimizer{REfile: refile,
 					Clmfile: extractor.OutClmfile,
 					RunGA:   !skipGA, Resume: resume,
-					Seed: seed, NPop: npop, NGen: ngen, MutProb: mutpb}
+					Seed: seed, NPop: npop, NGen: ngen, MutProb: mutpb, CrossProb: crosspb,
+					MinSize: minSize, Limit: limit, NContestants: nContestants, MaxGen: maxGen,
+					NIslands: nIslands, MigFrequency: migFrequency, NMigrants: nMigrants,
+					Score: score, Distfile: distfile, Crossover: crossover, Method: method,
+					NStarts: nStarts, Parallel: parallel, ExactSize: exactSize,
+					OrientInit: orientInit, OrientSearch: orientSearch}
 				optimizer.Run()
 				tourfiles = append(tourfiles, optimizer.OutTourFile)
 			}
@@ -298,7 +430,8 @@ A convenience driver function. Chain the following steps sequentially.
 				fmt.Sprintf("asm-g%d.chr.fasta", k))
 			builder := Builder{Tourfiles: tourfiles,
 				Fastafile:    fastafile,
-				OutFastafile: outfastafile}
+				OutFastafile: outfastafile,
+				Order:        OrderNatural}
 			builder.Run()
 		},
 	}
@@ -309,12 +442,29 @@ A convenience driver function. Chain the following steps sequentially.
 	pipelineCmd.Flags().IntVarP(&maxLinkDensity, "maxLinkDensity", "", MaxLinkDensity, "Density threshold before marking contig as repetive (CLUSTER_MAX_LINK_DENSITY in LACHESIS)")
 	pipelineCmd.Flags().IntVarP(&nonInformativeRatio, "nonInformativeRatio", "", NonInformativeRatio, "cutoff for recovering skipped contigs back into the clusters (CLUSTER_NON-INFORMATIVE_RATIO in LACHESIS)")
 
-	pipelineCmd.Flags().BoolVarP(&skipGA, "skipGA", "", false, "Skip GA step")
+	pipelineCmd.Flags().BoolVarP(&skipGA, "skipGA", "", false, "Skip GA step (or the ordering --method)")
+	pipelineCmd.Flags().StringVarP(&method, "method", "", MethodGA, "Ordering optimizer, one of ga, sa, 2opt, oropt, memetic, exact")
 	pipelineCmd.Flags().BoolVarP(&resume, "resume", "", false, "Resume from existing tour file")
 	pipelineCmd.Flags().Int64VarP(&seed, "seed", "", Seed, "Random seed")
+	pipelineCmd.Flags().IntVarP(&nStarts, "starts", "", NStarts, "Number of seeds to try, the best tour is kept and the adjacency support is reported")
+	pipelineCmd.Flags().BoolVarP(&parallel, "parallel", "", false, "Run the starts in parallel")
 	pipelineCmd.Flags().IntVarP(&npop, "npop", "", Npop, "Population size")
 	pipelineCmd.Flags().IntVarP(&ngen, "ngen", "", Ngen, "Number of generations for convergence")
 	pipelineCmd.Flags().Float64VarP(&mutpb, "mutapb", "", MutaProb, "Mutation prob in GA")
+	pipelineCmd.Flags().Float64VarP(&crosspb, "crosspb", "", CrossoverProb, "Crossover prob in GA")
+	pipelineCmd.Flags().StringVarP(&crossover, "crossover", "", CrossoverOX, "Crossover operator in GA, one of ox, pmx, erx")
+	pipelineCmd.Flags().IntVarP(&minSize, "minsize", "", 0, "Tigs smaller than this are left out of the tour, 0 keeps all")
+	pipelineCmd.Flags().IntVarP(&limit, "limit", "", LIMIT, "Largest distance for two tigs to add to total score")
+	pipelineCmd.Flags().IntVarP(&nContestants, "ncontestants", "", NContestants, "Tournament size in GA selection")
+	pipelineCmd.Flags().IntVarP(&maxGen, "maxgen", "", MaxGen, "Hard cap on the number of generations in GA")
+	pipelineCmd.Flags().IntVarP(&nIslands, "islands", "", NIslands, "Number of populations evolved in parallel in GA")
+	pipelineCmd.Flags().IntVarP(&migFrequency, "migfreq", "", MigFrequency, "Number of generations between migrations of the best tours across islands")
+	pipelineCmd.Flags().IntVarP(&nMigrants, "migrants", "", NMigrants, "Number of best tours sent to the next island in a migration")
+	pipelineCmd.Flags().IntVarP(&exactSize, "exactsize", "", 0, "Groups with at most this many tigs are solved exactly (proven optimum, or refined by --method if not proven), 0 to skip")
+	pipelineCmd.Flags().StringVarP(&orientInit, "orientinit", "", OrientEigen, "Initial orientations, one of eigen, gw")
+	pipelineCmd.Flags().StringVarP(&orientSearch, "orientsearch", "", OrientOne, "Refinement of orientations, one of one, kl")
+	pipelineCmd.Flags().StringVarP(&score, "score", "", ScoreRecip, "Score to evaluate tours, one of recip, sumlog, likelihood, ml")
+	pipelineCmd.Flags().StringVarP(&distfile, "distribution", "", "", "Link size distribution from extract for likelihood score (default: clmfile prefix + .distribution.txt)")
 
-	rootCmd.AddCommand(extractCmd, allelesCmd, pruneCmd, partitionCmd, optimizeCmd, buildCmd, plotCmd, assessCmd, pipelineCmd)
+	rootCmd.AddCommand(extractCmd, allelesCmd, pruneCmd, partitionCmd, optimizeCmd, buildCmd, agpCmd, liftoverCmd, plotCmd, assessCmd, pipelineCmd)
 }
@@ -622,21 +622,23 @@ func getL50(paths PathSet) int64 {
 }
 
 // parseTourFile parses tour file
-// Only the last line is retained anc onverted into a Tour
+// Only the last tour is retained and converted into a Tour
 func (r *Anchorer) parseTourFile(filename string) {
-	words := parseTourFile(filename)
+	tf, err := ReadTourFile(filename)
+	ErrorAbort(err)
+	record, err := tf.Last()
+	ErrorAbort(err)
 	tigs := make([]*Contig, 0)
 
-	for _, word := range words {
-		tigName, tigOrientation := word[:len(word)-1], word[len(word)-1]
-		tig, ok := r.nameToContig[tigName]
+	for _, c := range record.Contigs {
+		tig, ok := r.nameToContig[c.Name]
 		if !ok {
-			log.Errorf("Contig %s not found! Skipped", tigName)
+			log.Errorf("Contig %s not found! Skipped", c.Name)
 			continue
 		}
 		tigs = append(tigs, tig)
 		tig.orientation = 1
-		if tigOrientation == '-' {
+		if c.Sign == '-' {
 			tig.orientation = -1
 		}
 	}
@@ -647,16 +649,15 @@ func (r *Anchorer) parseTourFile(filename string) {
 
 // printTour logs the current tour to file
 func (r *Anchorer) printTour(fwtour *os.File, label string) {
-	_, _ = fwtour.WriteString(">" + label + "\n")
-	atoms := make([]string, len(r.path.contigs))
+	record := TourRecord{Label: label, Contigs: make([]TourContig, len(r.path.contigs))}
 	for i, contig := range r.path.contigs {
-		sign := "+"
+		var sign byte = '+'
 		if contig.orientation < 0 {
-			sign = "-"
+			sign = '-'
 		}
-		atoms[i] = contig.name + sign
+		record.Contigs[i] = TourContig{contig.name, sign}
 	}
-	_, _ = fwtour.WriteString(strings.Join(atoms, " ") + "\n")
+	_ = record.Write(fwtour)
 }
 
 // ************** Graph-related ********************
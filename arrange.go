@@ -0,0 +1,323 @@
+/*
+ *  arrange.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/18/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"bufio"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// The groups from the tours are named g1, g2, ... in the order of the tour files, by
+// default in their natural order so that g10 comes after g2. They can also be ordered
+// by length, named and ordered by a mapping file, or named and oriented after the
+// best-matching reference chromosomes.
+
+const (
+	// OrderInput keeps the tour files in the order given
+	OrderInput = "input"
+	// OrderNatural sorts the tour files with the numbers compared by value
+	OrderNatural = "natural"
+	// OrderLength sorts the groups from the longest
+	OrderLength = "length"
+)
+
+// naturalLess compares the strings with the runs of digits compared as numbers
+func naturalLess(a, b string) bool {
+	isDigit := func(c byte) bool { return '0' <= c && c <= '9' }
+	for len(a) > 0 && len(b) > 0 {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			i, j := 0, 0
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+			x, y := strings.TrimLeft(a[:i], "0"), strings.TrimLeft(b[:j], "0")
+			if len(x) != len(y) {
+				return len(x) < len(y)
+			}
+			if x != y {
+				return x < y
+			}
+			a, b = a[i:], b[j:]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+// groups returns the names of the groups in the order of the entries
+func (r *OO) groups() []string {
+	var names []string
+	for i, line := range r.entries {
+		if i == 0 || line.id != r.entries[i-1].id {
+			names = append(names, line.id)
+		}
+	}
+	return names
+}
+
+// groupSizes sums the contig sizes in each group
+func (r *OO) groupSizes() map[string]int {
+	sizes := make(map[string]int)
+	for _, line := range r.entries {
+		sizes[line.id] += line.componentSize
+	}
+	return sizes
+}
+
+// arrange puts the groups in the given order, renames them, and reverses those in
+// flip, i.e. the contigs in reverse order and on the other strand
+func (r *OO) arrange(order []string, rename map[string]string, flip map[string]bool) {
+	members := make(map[string][]OOLine)
+	for _, line := range r.entries {
+		members[line.id] = append(members[line.id], line)
+	}
+	entries := make([]OOLine, 0, len(r.entries))
+	for _, id := range order {
+		lines := members[id]
+		if flip[id] {
+			n := len(lines)
+			reversed := make([]OOLine, n)
+			for i, line := range lines {
+				line.strand = flipSign(line.strand)
+				// The gap before each contig is the one after it before the flip
+				line.gapSize = 0
+				if i+1 < n {
+					line.gapSize = lines[i+1].gapSize
+				}
+				reversed[n-1-i] = line
+			}
+			lines = reversed
+		}
+		for _, line := range lines {
+			if name, ok := rename[id]; ok {
+				line.id = name
+			}
+			entries = append(entries, line)
+		}
+	}
+	r.entries = entries
+}
+
+// flipSign changes + to - and vice versa, an unknown orientation stays unknown
+func flipSign(sign byte) byte {
+	switch sign {
+	case '+':
+		return '-'
+	case '-':
+		return '+'
+	}
+	return sign
+}
+
+// sortTourfiles orders the tour files before they are named g1, g2, ...
+func (r *Builder) sortTourfiles() {
+	if r.Order == "" {
+		r.Order = OrderNatural
+	}
+	switch r.Order {
+	case OrderInput, OrderNatural, OrderLength:
+	default:
+		ErrorAbort(fmt.Errorf("invalid order %s, use one of input, natural, length", r.Order))
+	}
+	if r.Mapfile != "" && r.Reffile != "" {
+		ErrorAbort(fmt.Errorf("use either a mapping file or a reference, not both"))
+	}
+	if r.Order == OrderNatural {
+		sort.SliceStable(r.Tourfiles, func(i, j int) bool {
+			return naturalLess(r.Tourfiles[i], r.Tourfiles[j])
+		})
+	}
+}
+
+// arrangeGroups orders the groups by length, or by the mapping file or the reference
+// if any is given
+func (r *Builder) arrangeGroups(oo *OO, tourfiles map[string]string) {
+	switch {
+	case r.Mapfile != "":
+		order, rename := readGroupMapping(r.Mapfile, oo.groups(), tourfiles)
+		oo.arrange(order, rename, nil)
+	case r.Reffile != "":
+		order, rename, flip := matchReference(r.Reffile, oo)
+		oo.arrange(order, rename, flip)
+	case r.Order == OrderLength:
+		sizes := oo.groupSizes()
+		order := oo.groups()
+		sort.SliceStable(order, func(i, j int) bool { return sizes[order[i]] > sizes[order[j]] })
+		rename := make(map[string]string)
+		for i, id := range order {
+			rename[id] = fmt.Sprintf("g%d", i+1)
+			log.Noticef("%s (%d bp) => %s", tourfiles[id], sizes[id], rename[id])
+		}
+		oo.arrange(order, rename, nil)
+	}
+}
+
+// readGroupMapping parses the mapping file, each line has a group and its new name.
+// The group is the tour file, with or without its directory and extension, or the
+// default name like g1. The groups are ordered as in the file, and the groups not in
+// the file are kept after them.
+func readGroupMapping(mapfile string, groups []string, tourfiles map[string]string) ([]string, map[string]string) {
+	keys := make(map[string]string)
+	for _, id := range groups {
+		tourfile := tourfiles[id]
+		for _, key := range []string{id, tourfile, path.Base(tourfile),
+			RemoveExt(path.Base(tourfile))} {
+			keys[key] = id
+		}
+	}
+
+	log.Noticef("Parse mapping file `%s`", mapfile)
+	fh := mustOpen(mapfile)
+	defer fh.Close()
+	var order []string
+	rename := make(map[string]string)
+	names := make(map[string]bool)
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 || words[0][0] == '#' {
+			continue
+		}
+		if len(words) < 2 {
+			ErrorAbort(fmt.Errorf("expected a group and its name, got `%s`", scanner.Text()))
+		}
+		id, ok := keys[words[0]]
+		if !ok {
+			log.Warningf("Group %s not found in the tours, skipped", words[0])
+			continue
+		}
+		if _, ok := rename[id]; ok || names[words[1]] {
+			ErrorAbort(fmt.Errorf("group %s or name %s appears more than once", words[0], words[1]))
+		}
+		order = append(order, id)
+		rename[id] = words[1]
+		names[words[1]] = true
+		log.Noticef("%s => %s", tourfiles[id], words[1])
+	}
+	ErrorAbort(scanner.Err())
+	for _, id := range groups {
+		if _, ok := rename[id]; !ok {
+			if names[id] {
+				ErrorAbort(fmt.Errorf("group %s is not mapped but its name is taken", id))
+			}
+			log.Warningf("Group %s (%s) not in the mapping file, kept as is", id, tourfiles[id])
+			order = append(order, id)
+		}
+	}
+	return order, rename
+}
+
+// matchReference names each group after the reference chromosome that it aligns to
+// the most, from a PAF of the contigs aligned to the reference, with at most one group
+// for each chromosome. The groups are oriented so that the positions of the contigs
+// increase along the chromosome, and ordered by the chromosome names.
+func matchReference(reffile string, oo *OO) ([]string, map[string]string, map[string]bool) {
+	paf := PAFFile{PafFile: reffile}
+	paf.ParseRecords()
+
+	// Position of each contig in its group
+	type placement struct {
+		id     string
+		offset int
+		strand byte
+		size   int
+	}
+	placements := make(map[string]placement)
+	offsets := make(map[string]int)
+	for _, line := range oo.entries {
+		placements[line.componentID] = placement{line.id, offsets[line.id], line.strand, line.componentSize}
+		offsets[line.id] += line.componentSize
+	}
+
+	groups := oo.groups()
+	groupIdx := make(map[string]int)
+	for i, id := range groups {
+		groupIdx[id] = i
+	}
+	var chrs []string
+	chrIdx := make(map[string]int)
+	type point struct{ x, y, w float64 }
+	points := make(map[[2]int][]point)
+	for _, rec := range paf.Records {
+		p, ok := placements[rec.Query]
+		if !ok {
+			continue
+		}
+		if _, ok := chrIdx[rec.Target]; !ok {
+			chrIdx[rec.Target] = len(chrs)
+			chrs = append(chrs, rec.Target)
+		}
+		// Midpoints of the alignment in the group and on the chromosome
+		x := float64(rec.QueryStart+rec.QueryEnd) / 2
+		if p.strand == '-' {
+			x = float64(p.size) - x
+		}
+		key := [2]int{groupIdx[p.id], chrIdx[rec.Target]}
+		points[key] = append(points[key], point{float64(p.offset) + x,
+			float64(rec.TargetStart+rec.TargetEnd) / 2, float64(rec.NumMatches)})
+	}
+
+	// Assign the chromosomes to the groups with the most matching bases
+	n := max(len(groups), len(chrs))
+	weights := Make2DSlice(n, n)
+	for key, pts := range points {
+		for _, pt := range pts {
+			weights[key[0]][key[1]] += int(pt.w)
+		}
+	}
+	solution := maxBipartiteMatchingWithWeights(weights)
+
+	rename := make(map[string]string)
+	flip := make(map[string]bool)
+	var assigned, unassigned []string
+	for i, id := range groups {
+		j := solution[i]
+		if j >= len(chrs) || weights[i][j] == 0 {
+			log.Warningf("Group %s does not match any reference chromosome, kept as is", id)
+			unassigned = append(unassigned, id)
+			continue
+		}
+		// Weighted covariance of the positions in the group and on the chromosome
+		var sw, sx, sy, sxy float64
+		for _, pt := range points[[2]int{i, j}] {
+			sw += pt.w
+			sx += pt.w * pt.x
+			sy += pt.w * pt.y
+			sxy += pt.w * pt.x * pt.y
+		}
+		flip[id] = sxy/sw-(sx/sw)*(sy/sw) < 0
+		rename[id] = chrs[j]
+		assigned = append(assigned, id)
+		log.Noticef("%s => %s (%s matching bases, reversed=%v)", id, chrs[j],
+			Percentage(weights[i][j], sumRow(weights[i])), flip[id])
+	}
+	sort.SliceStable(assigned, func(a, b int) bool {
+		return naturalLess(rename[assigned[a]], rename[assigned[b]])
+	})
+	return append(assigned, unassigned...), rename, flip
+}
+
+// sumRow sums the weights in a row
+func sumRow(row []int) int {
+	total := 0
+	for _, w := range row {
+		total += w
+	}
+	return total
+}
@@ -18,6 +18,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/biogo/hts/bam"
 )
@@ -34,16 +35,32 @@ const probCutoff = .95
 //         out of the contig, assuming + orientation, and - orientation, separately
 // Step 3. Normalize the likelihood to get the posterior probability (implicit assumption)
 //         of equal prior probability for each contig
+//
+// All the sequences in the bedfile are assessed together, with the links read in a
+// single pass of the bamfile and one background distribution for the whole genome. The
+// sequences are then assessed in parallel. Seqid restricts the run to one sequence.
+// The contigs can also be taken from the AGP written by build, in place of the bedfile.
 type Assesser struct {
-	Bamfile       string
-	Bedfile       string
-	Seqid         string
-	seq           *ContigInfo
-	model         *LinkDensityModel
+	Bamfile string
+	Bedfile string
+	AGPfile string
+	Seqid   string
+	seq     *ContigInfo // All the intra-contig links
+	model   *LinkDensityModel
+	seqs    []*assessSeq
+}
+
+// assessSeq stores the contigs on one sequence in the bedfile and their links
+type assessSeq struct {
+	name          string
+	length        int
 	contigs       []BedLine
 	interLinksFwd [][]int // Contig link sizes assuming same dir
 	interLinksRev [][]int // Contig link sizes assuming other dir
 	postprob      []float64
+	nFwdBetter    int
+	nRevBetter    int
+	nHighConf     int
 }
 
 // BedLine stores the information from each line in the bedfile
@@ -57,11 +74,22 @@ type BedLine struct {
 
 // Run calls the Assessor
 func (r *Assesser) Run() {
-	r.readBed()
+	prefix := r.Seqid
+	if r.AGPfile != "" {
+		r.readAGP()
+		if prefix == "" {
+			prefix = RemoveExt(strings.TrimSuffix(r.AGPfile, ".gz"))
+		}
+	} else {
+		r.readBed()
+		if prefix == "" {
+			prefix = RemoveExt(r.Bedfile)
+		}
+	}
 	r.extractContigLinks()
-	r.makeModel(r.Seqid + ".distribution.txt")
+	r.makeModel(prefix + ".distribution.txt")
 	r.computePosteriorProb()
-	r.writePostProb(r.Seqid + ".postprob.txt")
+	r.writePostProb(prefix + ".postprob.txt")
 	log.Notice("Success")
 }
 
@@ -69,8 +97,10 @@ func (r *Assesser) Run() {
 // distribution, then power law is inferred for extrapolating higher values
 func (r *Assesser) makeModel(outfile string) {
 	contigSizes := make([]int, 0)
-	for _, contig := range r.contigs {
-		contigSizes = append(contigSizes, contig.size)
+	for _, s := range r.seqs {
+		for _, contig := range s.contigs {
+			contigSizes = append(contigSizes, contig.size)
+		}
 	}
 	m := NewLinkDensityModel()
 	m.makeBins()
@@ -86,9 +116,11 @@ func (r *Assesser) writePostProb(outfile string) {
 	w := bufio.NewWriter(f)
 
 	_, _ = fmt.Fprintf(w, PostProbHeader)
-	for i, contig := range r.contigs {
-		_, _ = fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%.4f\n",
-			contig.seqid, contig.start, contig.end, contig.name, r.postprob[i])
+	for _, s := range r.seqs {
+		for i, contig := range s.contigs {
+			_, _ = fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%.4f\n",
+				contig.seqid, contig.start, contig.end, contig.name, s.postprob[i])
+		}
 	}
 
 	_ = w.Flush()
@@ -102,33 +134,82 @@ func (r *Assesser) readBed() {
 	log.Noticef("Parse bedfile `%s`", r.Bedfile)
 	reader := bufio.NewReader(fh)
 
+	var contigs []BedLine
 	for {
 		row, err := reader.ReadString('\n')
 		row = strings.TrimSpace(row)
 		if row == "" && err == io.EOF {
 			break
 		}
-		words := strings.Split(row, "\t")
-		seqid := words[0]
-		if seqid != r.Seqid {
+		if row == "" || row[0] == '#' || strings.HasPrefix(row, "track") {
 			continue
 		}
+		words := strings.Split(row, "\t")
 		start, _ := strconv.Atoi(words[1])
 		// start-- // To handle sometimes 1-based offset
 		end, _ := strconv.Atoi(words[2])
-		r.contigs = append(r.contigs, BedLine{
-			seqid: seqid,
+		contigs = append(contigs, BedLine{
+			seqid: words[0],
 			start: start,
 			end:   end,
 			name:  words[3],
 			size:  end - start,
 		})
 	}
+	_ = fh.Close()
+	r.groupContigs(contigs)
+}
 
-	sort.Slice(r.contigs, func(i, j int) bool {
-		return r.contigs[i].start < r.contigs[j].start
-	})
-	log.Noticef("A total of %d contigs imported", len(r.contigs))
+// readAGP takes the contigs from the component lines in the AGP, as the intervals
+// on the objects
+func (r *Assesser) readAGP() {
+	agp, err := ReadAGPFile(r.AGPfile)
+	ErrorAbort(err)
+
+	var contigs []BedLine
+	for _, line := range agp.lines {
+		if line.isGap {
+			continue
+		}
+		contigs = append(contigs, BedLine{
+			seqid: line.object,
+			start: line.objectBeg - 1,
+			end:   line.objectEnd,
+			name:  line.componentID,
+			size:  line.objectEnd - line.objectBeg + 1,
+		})
+	}
+	r.groupContigs(contigs)
+}
+
+// groupContigs puts the contigs on their sequences, which are kept in the order they
+// first appear
+func (r *Assesser) groupContigs(contigs []BedLine) {
+	seqs := make(map[string]*assessSeq)
+	nContigs := 0
+	for _, contig := range contigs {
+		if r.Seqid != "" && contig.seqid != r.Seqid {
+			continue
+		}
+		s, ok := seqs[contig.seqid]
+		if !ok {
+			s = &assessSeq{name: contig.seqid}
+			seqs[contig.seqid] = s
+			r.seqs = append(r.seqs, s)
+		}
+		s.contigs = append(s.contigs, contig)
+		nContigs++
+	}
+
+	for _, s := range r.seqs {
+		sort.Slice(s.contigs, func(i, j int) bool {
+			return s.contigs[i].start < s.contigs[j].start
+		})
+	}
+	if r.Seqid != "" && len(r.seqs) == 0 {
+		log.Fatalf("Seq not found: %s", r.Seqid)
+	}
+	log.Noticef("A total of %d contigs on %d sequences imported", nContigs, len(r.seqs))
 }
 
 // checkInRange checks if a point position is within range
@@ -136,40 +217,56 @@ func checkInRange(pos, start, end int) bool {
 	return start <= pos && pos < end
 }
 
-// extractContigLinks builds the probability distribution of link sizes
+// contigAt returns the index of the contig that contains the position, or -1 if the
+// position is not on any contig
+func (r *assessSeq) contigAt(pos int) int {
+	i := sort.Search(len(r.contigs), func(i int) bool {
+		return r.contigs[i].end > pos
+	})
+	if i < len(r.contigs) && checkInRange(pos, r.contigs[i].start, r.contigs[i].end) {
+		return i
+	}
+	return -1
+}
+
+// extractContigLinks builds the probability distribution of link sizes, the links are
+// bucketed to the sequences in one pass of the bamfile
 func (r *Assesser) extractContigLinks() {
 	fh := mustOpen(r.Bamfile)
 	log.Noticef("Parse bamfile `%s`", r.Bamfile)
-	br, _ := bam.NewReader(fh, 0)
-
-	// We need the size of the SeqId to compute expected number of links
-	var s *ContigInfo
-	refs := br.Header().Refs()
-	for _, ref := range refs {
-		if ref.Name() == r.Seqid {
-			s = &ContigInfo{
-				name:   ref.Name(),
-				length: ref.Len(),
-				links:  []int{},
+	br, err := bam.NewReader(fh, 0)
+	ErrorAbort(err)
+
+	// We need the size of each sequence to compute expected number of links
+	r.seq = &ContigInfo{name: "genome", links: []int{}}
+	lengths := make(map[string]int)
+	for _, ref := range br.Header().Refs() {
+		lengths[ref.Name()] = ref.Len()
+	}
+	seqs := make(map[string]*assessSeq)
+	var found []*assessSeq
+	for _, s := range r.seqs {
+		length, ok := lengths[s.name]
+		if !ok {
+			if r.Seqid != "" {
+				log.Fatalf("Seq not found: %s", s.name)
 			}
-			r.seq = s
-			break
+			log.Warningf("Seq `%s` not found in the bamfile, skipped", s.name)
+			continue
 		}
+		s.length = length
+		s.interLinksFwd = make([][]int, len(s.contigs))
+		s.interLinksRev = make([][]int, len(s.contigs))
+		seqs[s.name] = s
+		found = append(found, s)
+		log.Noticef("Seq `%s` has size %d", s.name, s.length)
 	}
-	if s == nil {
-		log.Fatalf("Seq not found: %f", r.Seqid)
-		return
-	}
-	log.Noticef("Seq `%s` has size %d", s.name, s.length)
+	r.seqs = found
 
 	// Import links into pairs of contigs
-	r.interLinksFwd = make([][]int, len(r.contigs))
-	r.interLinksRev = make([][]int, len(r.contigs))
-	var a, b int
 	nIntraLinks := 0
 	nInterLinks := 0
 	nSkippedTooShort := 0
-	ci := 0 // Use this to index into r.contigs, the current contig under consideration
 	for {
 		rec, err := br.Read()
 		if err != nil {
@@ -179,9 +276,12 @@ func (r *Assesser) extractContigLinks() {
 			break
 		}
 
-		// Restrict the links to be within the current chromosome
-		at, bt := rec.Ref.Name(), rec.MateRef.Name()
-		if at != r.Seqid || bt != r.Seqid {
+		// Restrict the links to be within the same sequence
+		if rec.Ref.Name() != rec.MateRef.Name() {
+			continue
+		}
+		s, ok := seqs[rec.Ref.Name()]
+		if !ok {
 			continue
 		}
 
@@ -189,18 +289,14 @@ func (r *Assesser) extractContigLinks() {
 		//     ---a-- X|----- dist = a2 ----|         |--- dist = b ---|X ------ b2 ------
 		//     ==============================         ====================================
 		//             C1 (length L1)       |----D----|         C2 (length L2)
-		a, b = rec.Pos, rec.MatePos
-		if a < r.contigs[ci].start {
-			continue
-		}
+		a, b := rec.Pos, rec.MatePos
 
 		// Now we need to check if this pair of positions is a intra-contig or inter-contig link
-		// If the intervals are disjoint and the mapping lies between the intervals, then this could
-		// lead to a problem
-		for a > r.contigs[ci].end {
-			ci++
-			// fmt.Println(r.contigs[ci], a, nIntraLinks, nInterLinks)
+		ci := s.contigAt(a)
+		if ci == -1 {
+			continue
 		}
+		contig := s.contigs[ci]
 
 		link := abs(a - b)
 		if link < MinLinkDist {
@@ -210,7 +306,7 @@ func (r *Assesser) extractContigLinks() {
 
 		// For intra-contig link it's easy, just store the distance between two ends
 		// An intra-contig link
-		if checkInRange(b, r.contigs[ci].start, r.contigs[ci].end) {
+		if checkInRange(b, contig.start, contig.end) {
 			r.seq.links = append(r.seq.links, link)
 			nIntraLinks++
 			continue
@@ -223,15 +319,16 @@ func (r *Assesser) extractContigLinks() {
 		//   To check this is correct, link_start = contig_start ==> contig_end
 		//                        and, link_start = contig_end => contig_start
 		// An inter-contig link
-		r.interLinksFwd[ci] = append(r.interLinksFwd[ci], link)
+		s.interLinksFwd[ci] = append(s.interLinksFwd[ci], link)
 		// Assuming flipped orientation
-		link = abs(r.contigs[ci].start + r.contigs[ci].end - a - b)
-		r.interLinksRev[ci] = append(r.interLinksRev[ci], link)
+		link = abs(contig.start + contig.end - a - b)
+		s.interLinksRev[ci] = append(s.interLinksRev[ci], link)
 		nInterLinks++
 	}
 	log.Noticef("A total of %d intra-contig and %d inter-contig links imported (%d skipped, too short)",
 		nIntraLinks, nInterLinks, nSkippedTooShort)
 	_ = br.Close()
+	_ = fh.Close()
 }
 
 // ComputeLikelihood computes the likelihood of link sizes assuming + orientation
@@ -265,34 +362,54 @@ func posteriorProbability(L1, L2 float64) float64 {
 	return p1 / (p1 + p2)
 }
 
-// computePosteriorProb computes the posterior probability of the orientations
+// computePosteriorProb computes the posterior probability of the orientations, with
+// the sequences in parallel
 func (r *Assesser) computePosteriorProb() {
+	var wg sync.WaitGroup
+	for _, s := range r.seqs {
+		wg.Add(1)
+		go func(s *assessSeq) {
+			defer wg.Done()
+			r.computeSeqPosteriorProb(s)
+		}(s)
+	}
+	wg.Wait()
+
 	nFwdBetter := 0
 	nRevBetter := 0
 	nHighConf := 0
-	r.postprob = make([]float64, len(r.contigs))
-	for i := range r.contigs {
-		// if i > 100 {
-		// 	break
-		// }
-		// fmt.Println(contig)
-		fwdLogP := r.computeLikelihood(r.interLinksFwd[i])
-		revLogP := r.computeLikelihood(r.interLinksRev[i])
+	nContigs := 0
+	for _, s := range r.seqs {
+		log.Noticef("%s: same direction better: %d; opposite direction better: %d; high confidence: %d",
+			s.name, s.nFwdBetter, s.nRevBetter, s.nHighConf)
+		nFwdBetter += s.nFwdBetter
+		nRevBetter += s.nRevBetter
+		nHighConf += s.nHighConf
+		nContigs += len(s.contigs)
+	}
+	log.Noticef("Same direction better: %d; Opposite direction better: %d",
+		nFwdBetter, nRevBetter)
+	log.Noticef("High confidence (threshold %d%%): %s",
+		int(probCutoff*100.), Percentage(nHighConf, nContigs))
+}
+
+// computeSeqPosteriorProb computes the posterior probability of the orientations of
+// the contigs on one sequence
+func (r *Assesser) computeSeqPosteriorProb(s *assessSeq) {
+	s.postprob = make([]float64, len(s.contigs))
+	for i := range s.contigs {
+		fwdLogP := r.computeLikelihood(s.interLinksFwd[i])
+		revLogP := r.computeLikelihood(s.interLinksRev[i])
 		fwdProb := posteriorProbability(fwdLogP, revLogP)
-		r.postprob[i] = fwdProb
-		// fmt.Println(fwdLogP, revLogP, fwdProb)
+		s.postprob[i] = fwdProb
 
 		if fwdLogP > revLogP {
-			nFwdBetter++
+			s.nFwdBetter++
 			if fwdProb > probCutoff {
-				nHighConf++
+				s.nHighConf++
 			}
 		} else {
-			nRevBetter++
+			s.nRevBetter++
 		}
 	}
-	log.Noticef("Same direction better: %d; Opposite direction better: %d",
-		nFwdBetter, nRevBetter)
-	log.Noticef("High confidence (threshold %d%%): %d out of %d (%.1f%%)",
-		int(probCutoff*100.), nHighConf, len(r.contigs), float64(nHighConf)*100./float64(len(r.contigs)))
 }
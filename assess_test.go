@@ -0,0 +1,196 @@
+/*
+ *  assess_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/18/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/biogo/hts/bam"
+	"github.com/biogo/hts/sam"
+	"github.com/tanghaibao/allhic"
+)
+
+// writeTestBam simulates the links on chr1 with three contigs and chr2 with two, the
+// second contig on chr2 is reversed in the bedfile
+func writeTestBam(t *testing.T, dir string) (string, string) {
+	const contigSize = 200000
+	nContigs := map[string]int{"chr1": 3, "chr2": 2, "chr3": 1}
+	var refs []*sam.Reference
+	for _, name := range []string{"chr1", "chr2", "chr3"} {
+		ref, err := sam.NewReference(name, "", "", nContigs[name]*contigSize, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		refs = append(refs, ref)
+	}
+	header, err := sam.NewHeader(nil, refs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bamfile := path.Join(dir, "test.bam")
+	f, err := os.Create(bamfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := bam.NewWriter(f, header, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(ref, mRef *sam.Reference, a, b int) {
+		rec, err := sam.NewRecord("r", ref, mRef, a, b, 0, 60, nil, []byte("N"), nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rng := rand.New(rand.NewSource(42))
+	var bed strings.Builder
+	for _, ref := range refs[:2] {
+		n := nContigs[ref.Name()]
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(&bed, "%s\t%d\t%d\t%s_%d\n", ref.Name(), i*contigSize, (i+1)*contigSize,
+				ref.Name(), i)
+		}
+		// Position in the bedfile of a position in the true sequence
+		mapped := func(pos int) int {
+			if ref.Name() == "chr2" && pos >= contigSize {
+				return 3*contigSize - 1 - pos
+			}
+			return pos
+		}
+		for k := 0; k < 5000; k++ {
+			dist := int(float64(allhic.MinLinkDist) * math.Pow(2, 5*rng.Float64()))
+			a := rng.Intn(n*contigSize - dist)
+			a, b := mapped(a), mapped(a+dist)
+			write(ref, ref, a, b)
+			write(ref, ref, b, a)
+		}
+	}
+	// Links across the sequences and on a sequence not in the bedfile are ignored
+	write(refs[0], refs[1], 100, 100)
+	write(refs[2], refs[2], 100, 50000)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	bedfile := path.Join(dir, "test.bed")
+	if err := ioutil.WriteFile(bedfile, []byte(bed.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return bamfile, bedfile
+}
+
+func TestAssess(t *testing.T) {
+	dir := t.TempDir()
+	bamfile, bedfile := writeTestBam(t, dir)
+	p := allhic.Assesser{Bamfile: bamfile, Bedfile: bedfile}
+	p.Run()
+
+	contents, err := ioutil.ReadFile(path.Join(dir, "test.postprob.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	if lines[0]+"\n" != allhic.PostProbHeader {
+		t.Fatalf("Unexpected header %s", lines[0])
+	}
+	var names []string
+	for _, line := range lines[1:] {
+		words := strings.Split(line, "\t")
+		names = append(names, words[3])
+		prob, err := strconv.ParseFloat(words[4], 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if words[3] == "chr2_1" && prob >= .5 {
+			t.Fatalf("Expected chr2_1 to be reversed, got %s", line)
+		}
+		if words[0] == "chr1" && prob <= .5 {
+			t.Fatalf("Expected %s in the same direction, got %s", words[3], line)
+		}
+	}
+	if strings.Join(names, ",") != "chr1_0,chr1_1,chr1_2,chr2_0,chr2_1" {
+		t.Fatalf("Expected all contigs in one table, got %v", names)
+	}
+}
+
+func TestAssessAGP(t *testing.T) {
+	dir := t.TempDir()
+	bamfile, bedfile := writeTestBam(t, dir)
+	bed, err := ioutil.ReadFile(bedfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The same contigs as components in the AGP
+	var agp strings.Builder
+	partNumbers := make(map[string]int)
+	for _, line := range strings.Split(strings.TrimSpace(string(bed)), "\n") {
+		words := strings.Split(line, "\t")
+		start, _ := strconv.Atoi(words[1])
+		end, _ := strconv.Atoi(words[2])
+		partNumbers[words[0]]++
+		fmt.Fprintf(&agp, "%s\t%d\t%d\t%d\tW\t%s\t1\t%d\t+\n", words[0], start+1, end,
+			partNumbers[words[0]], words[3], end-start)
+	}
+	// Gzipped, as the AGP is not guessed from the name
+	agpfile := path.Join(dir, "scaffolds.agp.gz")
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	if _, err := zw.Write([]byte(agp.String())); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(agpfile, gz.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fromBed := allhic.Assesser{Bamfile: bamfile, Bedfile: bedfile}
+	fromBed.Run()
+	fromAGP := allhic.Assesser{Bamfile: bamfile, AGPfile: agpfile}
+	fromAGP.Run()
+	var tables [2][]byte
+	for i, filename := range []string{"test.postprob.txt", "scaffolds.postprob.txt"} {
+		if tables[i], err = ioutil.ReadFile(path.Join(dir, filename)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if string(tables[0]) != string(tables[1]) {
+		t.Fatalf("Expected the same table from the AGP as from the bedfile, got\n%s\nand\n%s",
+			tables[1], tables[0])
+	}
+}
+
+func TestPercentage(t *testing.T) {
+	for _, tc := range []struct {
+		a, b     int
+		expected string
+	}{{1, 4, "1 of 4 (25.0 %)"}, {0, 0, "0 of 0"}} {
+		if got := allhic.Percentage(tc.a, tc.b); got != tc.expected {
+			t.Fatalf("Expected %q, got %q", tc.expected, got)
+		}
+	}
+}
@@ -36,7 +36,7 @@ const (
 	PHI = 0.4812118250596684 // math.Log(1.61803398875)
 	// OUTLIERTHRESHOLD is how many deviation from MAD
 	OUTLIERTHRESHOLD = 3.5
-	// MINSIZE is the minimum size cutoff for tig to be considered
+	// MINSIZE is the default minimum size cutoff for tig to be considered
 	MINSIZE = 10000
 	// GeometricBinSize is the max/min ratio for each bin
 	GeometricBinSize = 1.0442737824274138403219664787399
@@ -69,6 +69,26 @@ const (
 	Ngen = 5000
 	// MutaProb is the mutation probability in GA
 	MutaProb = 0.2
+	// CrossoverProb is the crossover probability in GA, off by default
+	CrossoverProb = 0.0
+	// NContestants is the tournament size used in GA selection
+	NContestants = 3
+	// MaxGen is the hard cap on the number of generations in GA
+	MaxGen = 1000000
+	// NIslands is the number of populations evolved in parallel in GA
+	NIslands = 1
+	// MigFrequency is the number of generations between migrations across islands
+	MigFrequency = 100
+	// NMigrants is the number of best tours sent to the next island in a migration
+	NMigrants = 2
+	// NStarts is the number of seeds tried in optimize
+	NStarts = 1
+
+	/* build */
+
+	// DefaultGapSize is the size of the gaps of unknown size between contigs in build,
+	// AGP 2.1 requires 100 bp for U gaps
+	DefaultGapSize = 100
 
 	// *** The following parameters are modeled after LACHESIS ***
 
@@ -92,6 +112,12 @@ const (
 
 	// PostProbHeader is the first line in the postprob file
 	PostProbHeader = "#SeqID\tStart\tEnd\tContig\tPostProb\n"
+
+	// ConsensusHeader is the first line in the consensus.txt file
+	ConsensusHeader = "#Contig1\tContig2\tNumRuns\tFraction\n"
+
+	// OrientationHeader is the first line in the orientation.txt file
+	OrientationHeader = "#Contig\tOrientation\tScoreDiff\tConfidence\n"
 )
 
 // GArray contains golden array of size BB
@@ -304,6 +330,9 @@ func Make2DGArraySlice(m, n int) [][]GArray {
 
 // Percentage prints a human readable message of the percentage
 func Percentage(a, b int) string {
+	if b == 0 {
+		return fmt.Sprintf("%d of %d", a, b)
+	}
 	return fmt.Sprintf("%d of %d (%.1f %%)", a, b, float64(a)*100./float64(b))
 }
 
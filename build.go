@@ -10,23 +10,34 @@
 package allhic
 
 import (
-	"bufio"
 	"fmt"
-	"io"
-	"os"
 	"strings"
-
-	"github.com/shenwei356/bio/seq"
-	"github.com/shenwei356/bio/seqio/fastx"
 )
 
 // Builder reconstructs the genome release AGP and FASTA files
 type Builder struct {
 	Tourfiles []string
 	Fastafile string
+	Clmfile   string // Estimate the gap sizes from the links in the clmfile if set
+	Distfile  string // Link size distribution for the gap sizes
+	AGPfile   string // Build from this AGP instead of the tours if set
+	// Write the contigs not in any tour to OutUnplacedFastafile, instead of adding
+	// them as their own objects
+	SeparateUnplaced bool
+	// Order of the tour files (input or natural), or of the groups (length), natural
+	// if not set
+	Order   string
+	Mapfile string // Names and order of the groups if set
+	Reffile string // PAF of the contigs on a reference, to name and orient the groups
+	// Also write the scaffolds as a chain file and a GFA graph
+	WriteChain bool
+	WriteGFA   bool
 	// Output file
-	OutAGPfile   string
-	OutFastafile string
+	OutAGPfile           string
+	OutFastafile         string
+	OutUnplacedFastafile string
+	OutChainfile         string
+	OutGFAfile           string
 }
 
 // OOLine describes a simple contig entry in a scaffolding experiment
@@ -35,104 +46,212 @@ type OOLine struct {
 	componentID   string
 	componentSize int
 	strand        byte
+	gapSize       int // Estimated size of the gap before this contig, 0 if unknown
 }
 
 // OO describes a scaffolding experiment and contains an array of OOLine
 type OO struct {
-	seqs    map[string]*seq.Seq
+	src     contigSource
 	entries []OOLine
 }
 
-// getFastaSizes returns a dictionary of contig sizes
-func (r *OO) getFastaSizes(fastafile string) {
-	log.Noticef("Parse FASTA file `%s`", fastafile)
+// unplacedContigs returns the contigs not in any tour, in the order of the FASTA file
+func (r *OO) unplacedContigs() []string {
+	placed := make(map[string]bool)
+	for _, line := range r.entries {
+		placed[line.componentID] = true
+	}
+	var unplaced []string
+	for _, name := range r.src.names() {
+		if !placed[name] {
+			unplaced = append(unplaced, name)
+		}
+	}
+	return unplaced
+}
 
-	reader, _ := fastx.NewDefaultReader(fastafile)
-	seq.ValidateSeq = false
-	r.seqs = map[string]*seq.Seq{}
-	for {
-		rec, err := reader.Read()
-		if err == io.EOF || rec == nil {
-			break
+// checkUnplacedNames makes sure that no unplaced contig, which is written as its own
+// object, has the name of a group
+func checkUnplacedNames(groups, unplaced []string) error {
+	isGroup := make(map[string]bool)
+	for _, name := range groups {
+		isGroup[name] = true
+	}
+	var clashes []string
+	for _, name := range unplaced {
+		if isGroup[name] {
+			clashes = append(clashes, name)
 		}
-		name := string(rec.Name)
-		r.seqs[name] = rec.Seq.Clone()
 	}
+	if len(clashes) > 0 {
+		return fmt.Errorf("unplaced contigs %s have the same names as groups, rename the groups or the contigs",
+			strings.Join(clashes, ","))
+	}
+	return nil
 }
 
 // Add instantiates a new OOLine object and add to the array in OO
 func (r *OO) Add(scaffold, ctg string, ctgsize int, strand byte) {
-	o := OOLine{scaffold, ctg, ctgsize, strand}
+	o := OOLine{scaffold, ctg, ctgsize, strand, 0}
 	r.entries = append(r.entries, o)
 }
 
-// writeAGP converts the simplistic OOLine into AGP format
-func (r *Builder) writeAGP(oo *OO, gapSize int) {
-	r.OutAGPfile = RemoveExt(r.OutFastafile) + ".agp"
+// toAGP converts the simplistic OOLine into AGP format. The gaps sized by the Hi-C
+// links are N gaps, the others are U gaps of DefaultGapSize.
+func (r *OO) toAGP() *AGP {
 	gapType := "scaffold"
 	linkage := "yes"
 	evidence := "map"
 	prevObject := ""
 	objectBeg := 1
-	objectEnd := 1
 	partNumber := 0
-	componentType := 'W'
-	f, _ := os.Create(r.OutAGPfile)
-	w := bufio.NewWriter(f)
-	components := 0
+	agp := &AGP{}
+	addGap := func(object string, componentType byte, size int, evidence string) {
+		partNumber++
+		agp.lines = append(agp.lines, AGPLine{object: object,
+			objectBeg: objectBeg, objectEnd: objectBeg + size - 1, partNumber: partNumber,
+			componentType: componentType, isGap: true, gapLength: size,
+			gapType: gapType, linkage: linkage, linkageEvidence: []string{evidence}})
+		objectBeg += size
+	}
 
 	// Write AGP for each object group
-	for _, line := range oo.entries {
+	for _, line := range r.entries {
 		if line.id != prevObject {
 			prevObject = line.id
 			objectBeg = 1
 			partNumber = 0
 		}
-		if partNumber > 0 && gapSize > 0 {
-			if gapSize == 100 {
-				componentType = 'U'
-			} else {
-				componentType = 'N'
-			}
-			objectEnd = objectBeg + gapSize - 1
-			partNumber++
-			_, _ = fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%c\t%d\t%s\t%s\t%s\n",
-				line.id, objectBeg, objectEnd, partNumber,
-				componentType, gapSize, gapType, linkage, evidence)
-			objectBeg += gapSize
+		if partNumber > 0 && line.gapSize > 0 {
+			// Estimated gaps are sized by the Hi-C links
+			addGap(line.id, 'N', line.gapSize, gapEvidence)
+		} else if partNumber > 0 {
+			addGap(line.id, 'U', DefaultGapSize, evidence)
 		}
-		objectEnd = objectBeg + line.componentSize - 1
 		partNumber++
-		_, _ = fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%c\t%s\t%d\t%d\t%c\n",
-			line.id, objectBeg, objectEnd, partNumber,
-			'W', line.componentID, 1, line.componentSize, line.strand)
+		agp.lines = append(agp.lines, AGPLine{object: line.id,
+			objectBeg: objectBeg, objectEnd: objectBeg + line.componentSize - 1,
+			partNumber: partNumber, componentType: 'W', orientation: string(line.strand),
+			componentID: line.componentID, componentBeg: 1, componentEnd: line.componentSize})
 		objectBeg += line.componentSize
-		components++
 	}
-	_ = w.Flush()
-	log.Noticef("A total of %d tigs written to `%s`", components, r.OutAGPfile)
-	_ = f.Close()
+	if len(agp.lines) > 0 {
+		agp.lines[0].comments = []string{"#agp-version\t" + AGPVersion}
+	}
+	return agp
+}
+
+// writeAGP writes the AGP of the scaffolds next to the output FASTA
+func (r *Builder) writeAGP(agp *AGP) {
+	r.OutAGPfile = RemoveExt(r.OutFastafile) + ".agp"
+	ErrorAbort(agp.WriteFile(r.OutAGPfile))
+	log.Noticef("A total of %d tigs written to `%s`", len(agp.lines)-agp.nGaps(), r.OutAGPfile)
 }
 
 // Run kicks off the Build and constructs molecule using component FASTA sequence
 func (r *Builder) Run() {
-	oo := new(OO)
-	oo.getFastaSizes(r.Fastafile)
+	src, err := openContigSource(r.Fastafile)
+	ErrorAbort(err)
+	defer src.Close()
+	if r.AGPfile != "" {
+		r.buildFromAGP(src)
+		return
+	}
+	oo := &OO{src: src}
 	// oo.parseLastTour(r.Tourfile)
-	oo.mergeTours(r.Tourfiles)
-	r.writeAGP(oo, 100)
-	buildFasta(r.OutAGPfile, oo.seqs)
+	r.sortTourfiles()
+	tourfiles := oo.mergeTours(r.Tourfiles)
+	if r.Clmfile != "" {
+		if r.Distfile == "" {
+			r.Distfile = RemoveExt(r.Clmfile) + ".distribution.txt"
+		}
+		est, err := newGapEstimator(r.Clmfile, r.Distfile)
+		ErrorAbort(err)
+		oo.estimateGaps(est)
+	}
+	r.arrangeGroups(oo, tourfiles)
+	unplaced := oo.unplacedContigs()
+	ErrorAbort(checkUnplacedNames(oo.groups(), unplaced))
+	r.reportAccounting(oo, unplaced)
+
+	// Unplaced contigs are kept as they are, each as its own object
+	unplacedOO := &OO{src: src}
+	if !r.SeparateUnplaced {
+		unplacedOO = oo
+	}
+	for _, name := range unplaced {
+		size, _ := src.size(name)
+		unplacedOO.Add(name, name, size, '+')
+	}
+
+	agp := oo.toAGP()
+	r.writeAGP(agp)
+	buildFasta(agp, r.OutFastafile, src)
+	if r.SeparateUnplaced {
+		r.OutUnplacedFastafile = RemoveExt(r.OutFastafile) + ".unplaced.fasta"
+		unplacedAGP := unplacedOO.toAGP()
+		buildFasta(unplacedAGP, r.OutUnplacedFastafile, src)
+		// The graphs cover all the contigs, the unplaced ones as their own objects
+		agp = &AGP{lines: append(agp.lines[:len(agp.lines):len(agp.lines)], unplacedAGP.lines...)}
+	}
+	r.writeGraphs(agp, src)
+	log.Notice("Success")
+}
+
+// writeGraphs writes the chain and the GFA next to the output FASTA if asked for
+func (r *Builder) writeGraphs(agp *AGP, src contigSource) {
+	prefix := RemoveExt(strings.TrimSuffix(r.OutFastafile, ".gz"))
+	if r.WriteChain {
+		r.OutChainfile = prefix + ".chain"
+		ErrorAbort(writeChain(agp, contigSizes(src), r.OutChainfile))
+		log.Noticef("Chain file `%s` written", r.OutChainfile)
+	}
+	if r.WriteGFA {
+		r.OutGFAfile = prefix + ".gfa"
+		ErrorAbort(writeGFA(agp, contigSizes(src), r.OutGFAfile))
+		log.Noticef("GFA file `%s` written", r.OutGFAfile)
+	}
+}
+
+// reportAccounting logs how much of the input sequence is placed in the tours
+func (r *Builder) reportAccounting(oo *OO, unplaced []string) {
+	sizes := contigSizes(oo.src)
+	total, unplacedBp := 0, 0
+	for _, size := range sizes {
+		total += size
+	}
+	for _, name := range unplaced {
+		unplacedBp += sizes[name]
+	}
+	log.Noticef("Input: %d contigs, %d bp", len(sizes), total)
+	log.Noticef("Placed: %d contigs, %s bp", len(sizes)-len(unplaced),
+		Percentage(total-unplacedBp, total))
+	log.Noticef("Unplaced: %d contigs, %s bp", len(unplaced), Percentage(unplacedBp, total))
+}
+
+// buildFromAGP builds the FASTA from a curated AGP, which is validated against the
+// contig sizes first
+func (r *Builder) buildFromAGP(src contigSource) {
+	agp, err := ReadAGPFile(r.AGPfile)
+	ErrorAbort(err)
+	agp.mustValidate(r.AGPfile, contigSizes(src))
+	buildFasta(agp, r.OutFastafile, src)
+	r.writeGraphs(agp, src)
 	log.Notice("Success")
 }
 
 // mergeTours merges a number of tours typically generated by partition and optimize
-// In contrast to parseLastTour which only parse one tour
-func (r *OO) mergeTours(tourfiles []string) {
+// In contrast to parseLastTour which only parse one tour. Returns the tour file of
+// each group.
+func (r *OO) mergeTours(tourfiles []string) map[string]string {
+	groups := make(map[string]string)
 	for i, tourfile := range tourfiles {
 		seqid := fmt.Sprintf("g%d", i+1)
 		log.Noticef("Import `%s` => %s", tourfile, seqid)
 		r.parseLastTour(tourfile, seqid)
+		groups[seqid] = tourfile
 	}
+	return groups
 }
 
 // parseLastTour reads tour from file
@@ -141,17 +260,11 @@ func (r *OO) mergeTours(tourfiles []string) {
 // > name
 // contig1+ contig2- contig3?
 func (r *OO) parseLastTour(tourfile string, seqid string) {
-	words := parseTourFile(tourfile)
-	var strand byte
-	for _, tig := range words {
-		at, ao := tig[:len(tig)-1], tig[len(tig)-1]
-		if ao == '+' || ao == '-' || ao == '?' {
-			tig, strand = at, ao
-		} else {
-			strand = '?'
-		}
-		r.Add(seqid, tig, r.seqs[tig].Length(), strand)
-	}
+	tf, err := ReadTourFile(tourfile)
+	ErrorAbort(err)
+	record, err := tf.Last()
+	ErrorAbort(err)
+	r.addTour(seqid, record)
 }
 
 // ParseAllTours reads tour from file
@@ -160,28 +273,21 @@ func (r *OO) parseLastTour(tourfile string, seqid string) {
 // > name
 // contig1+ contig2- contig3?
 func (r *OO) ParseAllTours(tourfile string) {
-	log.Noticef("Parse tourfile `%s`", tourfile)
-
-	file := mustOpen(tourfile)
-	scanner := bufio.NewScanner(file)
-	var (
-		name   string
-		strand byte
-	)
-	for scanner.Scan() {
-		words := strings.Fields(scanner.Text())
-		if words[0][0] == '>' {
-			name = words[0][1:]
+	tf, err := ReadTourFile(tourfile)
+	ErrorAbort(err)
+	for _, record := range tf.Records {
+		r.addTour(record.Label, record)
+	}
+}
+
+// addTour adds the contigs of a tour to the scaffold, skipping those not in the FASTA
+func (r *OO) addTour(scaffold string, record TourRecord) {
+	for _, c := range record.Contigs {
+		size, ok := r.src.size(c.Name)
+		if !ok {
+			log.Errorf("Contig %s not found! Skipped", c.Name)
 			continue
 		}
-		for _, tig := range words {
-			at, ao := tig[:len(tig)-1], tig[len(tig)-1]
-			if ao == '+' || ao == '-' || ao == '?' {
-				tig, strand = at, ao
-			} else {
-				strand = '?'
-			}
-			r.Add(name, tig, r.seqs[tig].Length(), strand)
-		}
+		r.Add(scaffold, c.Name, size, c.Sign)
 	}
 }
@@ -0,0 +1,495 @@
+/*
+ *  build_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/18/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// writeTestContigs writes random sequences with the sizes of the simulated contigs,
+// and the tour of the contigs in their true order, where they are adjacent
+func writeTestContigs(t *testing.T, dir string) (string, string) {
+	ids, err := ioutil.ReadFile(path.Join("tests", "simulation", "test.ids"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fastafile := path.Join(dir, "tigs.fasta")
+	f, err := os.Create(fastafile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	rng := rand.New(rand.NewSource(42))
+	var atoms []string
+	for _, line := range strings.Split(strings.TrimSpace(string(ids)), "\n")[1:] {
+		words := strings.Fields(line)
+		size, _ := strconv.Atoi(words[2])
+		seq := make([]byte, size)
+		for i := range seq {
+			seq[i] = "ACGT"[rng.Intn(4)]
+		}
+		fmt.Fprintf(w, ">%s\n%s\n", words[0], seq)
+		atoms = append(atoms, words[0]+"+")
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	tourfile := path.Join(dir, "test.tour")
+	tour := ">TRUE\n" + strings.Join(atoms, " ") + "\n"
+	if err := ioutil.WriteFile(tourfile, []byte(tour), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fastafile, tourfile
+}
+
+func TestBuildEstimateGaps(t *testing.T) {
+	dir := t.TempDir()
+	fastafile, tourfile := writeTestContigs(t, dir)
+	p := allhic.Builder{Tourfiles: []string{tourfile},
+		Fastafile:    fastafile,
+		Clmfile:      path.Join("tests", "simulation", "test.clm"),
+		Distfile:     writeTestDistribution(t),
+		OutFastafile: path.Join(dir, "asm.fasta"),
+		WriteGFA:     true}
+	p.Run()
+
+	parsed, err := allhic.ReadAGPFile(p.OutAGPfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := parsed.Validate(nil); len(errs) > 0 {
+		t.Fatalf("Invalid AGP: %v", errs)
+	}
+	agp, err := ioutil.ReadFile(p.OutAGPfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var estimated []int
+	nGaps := 0
+	for _, line := range strings.Split(strings.TrimSpace(string(agp)), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		words := strings.Split(line, "\t")
+		switch words[4] {
+		case "N":
+			if words[8] != "proximity_ligation" {
+				t.Fatalf("Estimated gap without linkage evidence: %s", line)
+			}
+			size, _ := strconv.Atoi(words[5])
+			estimated = append(estimated, size)
+			nGaps++
+		case "U":
+			if words[5] != "100" {
+				t.Fatalf("Fallback gaps must be 100 bp: %s", line)
+			}
+			nGaps++
+		}
+	}
+	if nGaps != 99 {
+		t.Fatalf("Expected 99 gaps, got %d", nGaps)
+	}
+	// The simulated contigs are adjacent, so most of the gaps should be small
+	if len(estimated) < 90 {
+		t.Fatalf("Expected most gaps to be estimated, got %d", len(estimated))
+	}
+	sort.Ints(estimated)
+	if median := estimated[len(estimated)/2]; median > 1000 {
+		t.Fatalf("Expected small gaps between adjacent contigs, median is %d", median)
+	}
+	// Only the estimated gaps have their size in the GFA
+	gfa, err := ioutil.ReadFile(p.OutGFAfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sized := strings.Count(string(gfa), "\t"+allhic.GFAGapTag+":"); sized != len(estimated) {
+		t.Fatalf("Expected %d links with the gap size, got %d", len(estimated), sized)
+	}
+}
+
+// readTestFasta reads the sequences in a FASTA file with one or more lines per sequence
+func readTestFasta(t *testing.T, filename string) map[string]string {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builders := make(map[string]*strings.Builder)
+	var b *strings.Builder
+	for _, line := range strings.Split(string(contents), "\n") {
+		if strings.HasPrefix(line, ">") {
+			b = new(strings.Builder)
+			builders[strings.Fields(line[1:])[0]] = b
+		} else if b != nil {
+			b.WriteString(strings.TrimSpace(line))
+		}
+	}
+	seqs := make(map[string]string)
+	for name, b := range builders {
+		seqs[name] = b.String()
+	}
+	return seqs
+}
+
+// revcom is the reverse complement of a DNA sequence
+func revcom(s string) string {
+	complement := map[byte]byte{'A': 'T', 'C': 'G', 'G': 'C', 'T': 'A'}
+	rc := make([]byte, len(s))
+	for i := range s {
+		rc[len(s)-1-i] = complement[s[i]]
+	}
+	return string(rc)
+}
+
+func TestBuildFromAGP(t *testing.T) {
+	dir := t.TempDir()
+	fastafile, _ := writeTestContigs(t, dir)
+	tigs := readTestFasta(t, fastafile)
+
+	// tig0000 is split into two scaffolds, with the second half reversed
+	size := len(tigs["tig0000"])
+	half := size / 2
+	agp := fmt.Sprintf("##agp-version\t2.1\n"+
+		"s1\t1\t%d\t1\tW\ttig0000\t1\t%d\t+\n"+
+		"s1\t%d\t%d\t2\tU\t100\tscaffold\tyes\tproximity_ligation\n"+
+		"s1\t%d\t%d\t3\tW\ttig0001\t1\t%d\t-\n"+
+		"s2\t1\t%d\t1\tW\ttig0000\t%d\t%d\t-\n",
+		half, half,
+		half+1, half+100,
+		half+101, half+100+len(tigs["tig0001"]), len(tigs["tig0001"]),
+		size-half, half+1, size)
+	agpfile := path.Join(dir, "curated.agp")
+	if err := ioutil.WriteFile(agpfile, []byte(agp), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p := allhic.Builder{Fastafile: fastafile, AGPfile: agpfile,
+		WriteChain: true, WriteGFA: true,
+		OutFastafile: path.Join(dir, "curated.fasta")}
+	p.Run()
+
+	built := readTestFasta(t, p.OutFastafile)
+	expected := map[string]string{
+		"s1": tigs["tig0000"][:half] + strings.Repeat("N", 100) + revcom(tigs["tig0001"]),
+		"s2": revcom(tigs["tig0000"][half:]),
+	}
+	for name, s := range expected {
+		if built[name] != s {
+			t.Fatalf("Unexpected sequence of %s (%d bp, expected %d bp)", name, len(built[name]), len(s))
+		}
+	}
+	if len(built) != len(expected) {
+		t.Fatalf("Expected %d sequences, got %d", len(expected), len(built))
+	}
+
+	// Chain from the contigs to the objects, on the reverse of the object for '-'
+	size1 := len(tigs["tig0001"])
+	s1 := half + 100 + size1
+	expectedChain := fmt.Sprintf("chain %d tig0000 %d + 0 %d s1 %d + 0 %d 1\n%d\n\n"+
+		"chain %d tig0001 %d + 0 %d s1 %d - 0 %d 2\n%d\n\n"+
+		"chain %d tig0000 %d + %d %d s2 %d - 0 %d 3\n%d\n\n",
+		half, size, half, s1, half, half,
+		size1, size1, size1, s1, size1, size1,
+		size-half, size, half, size, size-half, size-half, size-half)
+	expectedGFA := fmt.Sprintf("H\tVN:Z:1.0\n"+
+		"S\ttig0000:1-%d\t*\tLN:i:%d\n"+
+		"S\ttig0001\t*\tLN:i:%d\n"+
+		"S\ttig0000:%d-%d\t*\tLN:i:%d\n"+
+		"L\ttig0000:1-%d\t+\ttig0001\t-\t0M\n"+ // No size for the U gap
+		"P\ts1\ttig0000:1-%d+,tig0001-\t*\n"+
+		"P\ts2\ttig0000:%d-%d-\t*\n",
+		half, half, size1, half+1, size, size-half, half, half, half+1, size)
+	for filename, expected := range map[string]string{
+		p.OutChainfile: expectedChain, p.OutGFAfile: expectedGFA} {
+		contents, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(contents) != expected {
+			t.Fatalf("Expected %s:\n%s\ngot\n%s", filename, expected, contents)
+		}
+	}
+}
+
+func TestBuildUnplaced(t *testing.T) {
+	dir := t.TempDir()
+	fastafile, _ := writeTestContigs(t, dir)
+	tigs := readTestFasta(t, fastafile)
+	tourfile := path.Join(dir, "partial.tour")
+	if err := ioutil.WriteFile(tourfile, []byte(">PARTIAL\ntig0003+ tig0001-\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, separate := range []bool{false, true} {
+		p := allhic.Builder{Tourfiles: []string{tourfile}, Fastafile: fastafile,
+			SeparateUnplaced: separate, OutFastafile: path.Join(dir, "asm.fasta"),
+			WriteChain: true, WriteGFA: true}
+		p.Run()
+		built := readTestFasta(t, p.OutFastafile)
+		if separate {
+			unplaced := readTestFasta(t, p.OutUnplacedFastafile)
+			if len(built) != 1 || len(unplaced) != len(tigs)-2 {
+				t.Fatalf("Expected 1 scaffold and %d unplaced, got %d and %d",
+					len(tigs)-2, len(built), len(unplaced))
+			}
+			built = unplaced
+		} else if len(built) != len(tigs)-1 {
+			t.Fatalf("Expected 1 scaffold and %d unplaced, got %d sequences",
+				len(tigs)-2, len(built))
+		}
+		// Every contig outside the tour is kept as it is
+		for name, s := range tigs {
+			if name != "tig0001" && name != "tig0003" && built[name] != s {
+				t.Fatalf("Unplaced contig %s is not in the output (separate=%v)", name, separate)
+			}
+		}
+		// The chain and the GFA have every contig
+		chain, err := ioutil.ReadFile(p.OutChainfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gfa, err := ioutil.ReadFile(p.OutGFAfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name := range tigs {
+			if !strings.Contains(string(chain), " "+name+" ") ||
+				!strings.Contains(string(gfa), "S\t"+name+"\t") {
+				t.Fatalf("Contig %s is not in the chain or the GFA (separate=%v)", name, separate)
+			}
+		}
+	}
+}
+
+func TestCheckUnplacedNames(t *testing.T) {
+	groups := []string{"g1", "g2", "chr1"}
+	if err := allhic.CheckUnplacedNames(groups, []string{"tig0001", "tig0002"}); err != nil {
+		t.Fatal(err)
+	}
+	err := allhic.CheckUnplacedNames(groups, []string{"tig0001", "chr1", "g2"})
+	if err == nil || !strings.Contains(err.Error(), "chr1,g2") {
+		t.Fatalf("Expected chr1 and g2 to clash with the groups, got %v", err)
+	}
+}
+
+// writeIndexedFasta writes the contigs in lines of 70 bp, both uncompressed and in
+// gzip blocks like bgzip, with the .fai and .gzi indices
+func writeIndexedFasta(t *testing.T, dir string, names []string, tigs map[string]string) (string, string) {
+	var fasta, fai bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&fasta, ">%s description\n", name)
+		s := tigs[name]
+		fmt.Fprintf(&fai, "%s\t%d\t%d\t70\t71\n", name, len(s), fasta.Len())
+		for i := 0; i < len(s); i += 70 {
+			end := i + 70
+			if end > len(s) {
+				end = len(s)
+			}
+			fmt.Fprintf(&fasta, "%s\n", s[i:end])
+		}
+	}
+	plainfile := path.Join(dir, "indexed.fasta")
+	bgzipfile := path.Join(dir, "indexed.fasta.gz")
+	for _, filename := range []string{plainfile, bgzipfile} {
+		if err := ioutil.WriteFile(filename+".fai", fai.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(plainfile, fasta.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Compress in blocks of 10 kb, and record the offsets of the blocks after the first
+	var compressed bytes.Buffer
+	var offsets []uint64
+	data := fasta.Bytes()
+	for i := 0; i < len(data); i += 10000 {
+		if i > 0 {
+			offsets = append(offsets, uint64(compressed.Len()), uint64(i))
+		}
+		end := i + 10000
+		if end > len(data) {
+			end = len(data)
+		}
+		gz := gzip.NewWriter(&compressed)
+		if _, err := gz.Write(data[i:end]); err != nil {
+			t.Fatal(err)
+		}
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(bgzipfile, compressed.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var gzi bytes.Buffer
+	_ = binary.Write(&gzi, binary.LittleEndian, uint64(len(offsets)/2))
+	_ = binary.Write(&gzi, binary.LittleEndian, offsets)
+	if err := ioutil.WriteFile(bgzipfile+".gzi", gzi.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return plainfile, bgzipfile
+}
+
+func TestBuildIndexed(t *testing.T) {
+	dir := t.TempDir()
+	fastafile, _ := writeTestContigs(t, dir)
+	tigs := readTestFasta(t, fastafile)
+	names := make([]string, 0, len(tigs))
+	for name := range tigs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	plainfile, bgzipfile := writeIndexedFasta(t, dir, names, tigs)
+	tourfile := path.Join(dir, "mixed.tour")
+	if err := ioutil.WriteFile(tourfile, []byte(">MIXED\ntig0005- tig0002+ tig0007-\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gap := strings.Repeat("N", 100)
+	scaffold := revcom(tigs["tig0005"]) + gap + tigs["tig0002"] + gap + revcom(tigs["tig0007"])
+
+	// Single-line FASTA indexed on the fly, then with .fai, and bgzipped with .gzi
+	for _, input := range []string{fastafile, plainfile, bgzipfile} {
+		p := allhic.Builder{Tourfiles: []string{tourfile}, Fastafile: input,
+			OutFastafile: path.Join(dir, "asm.fasta")}
+		p.Run()
+		built := readTestFasta(t, p.OutFastafile)
+		if built["g1"] != scaffold {
+			t.Fatalf("Unexpected scaffold from %s (%d bp, expected %d bp)",
+				input, len(built["g1"]), len(scaffold))
+		}
+		for _, name := range names {
+			if name != "tig0002" && name != "tig0005" && name != "tig0007" && built[name] != tigs[name] {
+				t.Fatalf("Unexpected unplaced contig %s from %s", name, input)
+			}
+		}
+	}
+}
+
+// agpObjects returns the objects in the AGP in order, with their components
+func agpObjects(t *testing.T, agpfile string) ([]string, map[string][]string) {
+	contents, err := ioutil.ReadFile(agpfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var objects []string
+	components := make(map[string][]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(contents)), "\n") {
+		words := strings.Split(line, "\t")
+		if line[0] == '#' || words[4] == "U" || words[4] == "N" {
+			continue
+		}
+		if _, ok := components[words[0]]; !ok {
+			objects = append(objects, words[0])
+		}
+		components[words[0]] = append(components[words[0]], words[5]+words[8])
+	}
+	return objects, components
+}
+
+func TestBuildArrange(t *testing.T) {
+	dir := t.TempDir()
+	fastafile, _ := writeTestContigs(t, dir)
+	tigs := readTestFasta(t, fastafile)
+	// Tours t1 to t12, with i + 1 contigs in ti, in the order tig0000, tig0001, ...
+	var tourfiles []string
+	k := 0
+	for i := 1; i <= 12; i++ {
+		var atoms []string
+		for j := 0; j <= i; j++ {
+			atoms = append(atoms, fmt.Sprintf("tig%04d+", k))
+			k++
+		}
+		tourfile := path.Join(dir, fmt.Sprintf("t%d.tour", i))
+		if err := ioutil.WriteFile(tourfile, []byte(">T\n"+strings.Join(atoms, " ")+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		tourfiles = append(tourfiles, tourfile)
+	}
+	sort.Strings(tourfiles) // t1, t10, t11, t12, t2, ...
+	build := func(p allhic.Builder) ([]string, map[string][]string) {
+		p.Tourfiles = append([]string(nil), tourfiles...)
+		p.Fastafile, p.OutFastafile = fastafile, path.Join(dir, "asm.fasta")
+		p.Run()
+		objects, components := agpObjects(t, p.OutAGPfile)
+		return objects[:12], components // Unplaced contigs follow
+	}
+
+	// Natural order, t10 is g10, also by default
+	for _, order := range []string{allhic.OrderNatural, ""} {
+		objects, components := build(allhic.Builder{Order: order})
+		if objects[9] != "g10" || len(components["g10"]) != 11 || len(components["g2"]) != 3 {
+			t.Fatalf("Expected t10 as g10 in natural order, got %v", objects)
+		}
+	}
+
+	// By length, the longest first
+	objects, components := build(allhic.Builder{Order: allhic.OrderLength})
+	for i := 1; i < len(objects); i++ {
+		size := func(object string) int {
+			total := 0
+			for _, c := range components[object] {
+				total += len(tigs[c[:len(c)-1]])
+			}
+			return total
+		}
+		if objects[i] != fmt.Sprintf("g%d", i+1) || size(objects[i]) > size(objects[i-1]) {
+			t.Fatalf("Expected g%d to be shorter than g%d, got %v", i+1, i, objects)
+		}
+	}
+
+	// By the mapping file, the rest are kept after the mapped ones
+	mapfile := path.Join(dir, "mapping.txt")
+	if err := ioutil.WriteFile(mapfile, []byte("t3\tchrA\ng1\tchrB\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	objects, components = build(allhic.Builder{Order: allhic.OrderNatural, Mapfile: mapfile})
+	if objects[0] != "chrA" || objects[1] != "chrB" || objects[2] != "g2" ||
+		len(components["chrA"]) != 4 || len(components["chrB"]) != 2 {
+		t.Fatalf("Unexpected objects from the mapping file %v", objects)
+	}
+
+	// By the reference, t1 aligns to chr2 in reverse, t2 aligns to chr1
+	var paf strings.Builder
+	for i, tig := range []string{"tig0000", "tig0001"} {
+		size := len(tigs[tig])
+		fmt.Fprintf(&paf, "%s\t%d\t0\t%d\t+\tchr2\t1000000\t%d\t%d\t%d\t%d\t60\n",
+			tig, size, size, 500000-i*200000, 500000-i*200000+size, size, size)
+	}
+	for i, tig := range []string{"tig0002", "tig0003", "tig0004"} {
+		size := len(tigs[tig])
+		fmt.Fprintf(&paf, "%s\t%d\t0\t%d\t+\tchr1\t1000000\t%d\t%d\t%d\t%d\t60\n",
+			tig, size, size, i*200000, i*200000+size, size, size)
+	}
+	reffile := path.Join(dir, "ref.paf")
+	if err := ioutil.WriteFile(reffile, []byte(paf.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	objects, components = build(allhic.Builder{Order: allhic.OrderNatural, Reffile: reffile})
+	if objects[0] != "chr1" || objects[1] != "chr2" ||
+		strings.Join(components["chr1"], " ") != "tig0002+ tig0003+ tig0004+" ||
+		strings.Join(components["chr2"], " ") != "tig0001- tig0000-" {
+		t.Fatalf("Unexpected objects from the reference %v: %v %v",
+			objects, components["chr1"], components["chr2"])
+	}
+}
@@ -11,6 +11,8 @@ package allhic
 
 import (
 	"bufio"
+	"bytes"
+	"fmt"
 	"io"
 	"math"
 	"math/rand"
@@ -34,7 +36,6 @@ type CLM struct {
 	Clmfile          string
 	Tigs             []*TigF
 	Tour             Tour
-	Signs            []byte
 	tigToIdx         map[string]int          // From name of the tig to the idx of the Tigs array
 	contacts         map[Pair]Contact        // (tigA, tigB) => {strandedness, nlinks, meanDist}
 	orientedContacts map[OrientedPair]GArray // (tigA, tigB, oriA, oriB) => golden array i.e. exponential histogram
@@ -82,12 +83,17 @@ type TigF struct {
 type Tig struct {
 	Idx  int
 	Size int
+	Sign byte // Orientation of the tig, '+' or '-'
 }
 
 // Tour stores a number of tigs along with 2D matrices for evaluation
 type Tour struct {
-	Tigs []Tig
-	M    [][]int
+	Tigs   []Tig
+	M      [][]int
+	Limit  int           // Largest distance for two tigs to add to total score
+	Scorer Scorer        // Objective function, nil means EvaluateSumRecip
+	Cross  CrossoverFunc // Recombination operator in GA, nil means CrossOX
+	cache  *tourCache    // Score kept up to date by the mutations in GA
 }
 
 // RECountsRecord contains a line in the RE file
@@ -271,7 +277,7 @@ func (r *CLM) calculateDensities() ([]float64, []int) {
 }
 
 // pruneByDensity selects active contigs based on logdensities
-func (r *CLM) pruneByDensity() {
+func (r *CLM) pruneByDensity(minSize int) {
 	for {
 		logdensities, active := r.calculateDensities()
 		lb, ub := OutlierCutoff(logdensities)
@@ -279,7 +285,7 @@ func (r *CLM) pruneByDensity() {
 		invalid := 0
 		for i, idx := range active {
 			tig := r.Tigs[idx]
-			if logdensities[i] < lb && tig.Size < MINSIZE*10 {
+			if logdensities[i] < lb && tig.Size < minSize*10 {
 				r.Tigs[idx].IsActive = false
 				invalid++
 			}
@@ -293,19 +299,29 @@ func (r *CLM) pruneByDensity() {
 	}
 }
 
-// pruneBySize selects active contigs based on size
-func (r *CLM) pruneBySize() {
-	invalid := 0
+// pruneBySize inactivates the contigs smaller than minSize, it is an error if no
+// contig is left
+func (r *CLM) pruneBySize(minSize int) error {
+	invalid, active := 0, 0
 	for i, tig := range r.Tigs {
-		if tig.Size < MINSIZE {
+		if !tig.IsActive {
+			continue
+		}
+		if tig.Size < minSize {
 			r.Tigs[i].IsActive = false
 			invalid++
+		} else {
+			active++
 		}
 	}
 	if invalid > 0 {
 		log.Noticef("Inactivated %d tigs with size < %d",
-			invalid, MINSIZE)
+			invalid, minSize)
 	}
+	if active == 0 && invalid > 0 {
+		return fmt.Errorf("all %d tigs have size < %d, use a smaller minsize", invalid, minSize)
+	}
+	return nil
 }
 
 // pruneTour test deleting each contig and check the delta_score
@@ -326,6 +342,7 @@ func (r *CLM) pruneTour() {
 			newTour = tour.Clone().(Tour)
 			copy(newTour.Tigs[i:], newTour.Tigs[i+1:]) // Delete element at i
 			newTour.Tigs = newTour.Tigs[:newTour.Len()-1]
+			newTour.invalidate()
 
 			wg.Add(1)
 			go func(idx int, newTour Tour) {
@@ -390,10 +407,9 @@ func (r *CLM) pruneTour() {
 //    tourfile. In this case, the active contig list and orientations are
 //    derived from the last tour in the file.
 func (r *CLM) Activate(shuffle bool, rng *rand.Rand) {
-	N := len(r.Tigs)
 	// if shuffle {
 	// 	r.reportActive(true)
-	// 	r.pruneByDensity()
+	// 	r.pruneByDensity(MINSIZE)
 	// }
 	activeCounts, _ := r.reportActive(true)
 
@@ -401,7 +417,7 @@ func (r *CLM) Activate(shuffle bool, rng *rand.Rand) {
 	idx := 0
 	for _, tig := range r.Tigs {
 		if tig.IsActive {
-			r.Tour.Tigs[idx] = Tig{tig.Idx, tig.Size}
+			r.Tour.Tigs[idx] = Tig{tig.Idx, tig.Size, '+'}
 			idx++
 		}
 	}
@@ -410,10 +426,6 @@ func (r *CLM) Activate(shuffle bool, rng *rand.Rand) {
 	if shuffle {
 		r.Tour.Shuffle(rng)
 	}
-	r.Signs = make([]byte, N)
-	for i := 0; i < N; i++ {
-		r.Signs[i] = '+'
-	}
 	r.flipAll() // Initialize with the signs of the tigs
 }
 
@@ -432,6 +444,17 @@ func (r *CLM) reportActive(verbose bool) (activeCounts, sumLength int) {
 	return
 }
 
+// Signs returns the orientation of each contig, indexed like Tigs, the contigs not
+// in the tour are '+'. It replaces the Signs field, the signs are now kept in the
+// Tour as Tig.Sign.
+func (r *CLM) Signs() []byte {
+	signs := bytes.Repeat([]byte{'+'}, len(r.Tigs))
+	for _, tig := range r.Tour.Tigs {
+		signs[tig.Idx] = tig.Sign
+	}
+	return signs
+}
+
 // M yields a contact frequency matrix, where each cell contains how many
 // links between i-th and j-th contig
 func (r *CLM) M() [][]int {
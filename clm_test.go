@@ -9,6 +9,7 @@
 package allhic_test
 
 import (
+	"math/rand"
 	"path"
 	"testing"
 
@@ -25,3 +26,15 @@ func TestParseRECountsFile(t *testing.T) {
 		t.Fatalf("Expected %d records, got %d records", expectedNumRecords, len(reCountsFile.Records))
 	}
 }
+
+func TestCLMSigns(t *testing.T) {
+	clm := allhic.NewCLM(path.Join("tests", "simulation", "test.clm"),
+		path.Join("tests", "simulation", "test.ids"))
+	clm.Activate(false, rand.New(rand.NewSource(42)))
+	tig := clm.Tour.Tigs[3]
+	clm.Tour.Tigs[3].Sign = '-'
+	signs := clm.Signs()
+	if len(signs) != len(clm.Tigs) || signs[tig.Idx] != '-' {
+		t.Fatalf("Expected the sign of tig %d from the tour, got %s", tig.Idx, signs)
+	}
+}
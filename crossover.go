@@ -0,0 +1,199 @@
+/*
+ *  crossover.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/18/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// The crossovers in eaopt look up genes by value, but the same tig may carry
+// different orientations in the two parents. Here the genes are matched on the tig
+// Idx instead, and each tig keeps the orientation from the parent it is copied from.
+
+const (
+	// CrossoverOX is the order crossover
+	CrossoverOX = "ox"
+	// CrossoverPMX is the partially mapped crossover
+	CrossoverPMX = "pmx"
+	// CrossoverERX is the edge recombination crossover
+	CrossoverERX = "erx"
+)
+
+// CrossoverFunc recombines two parent tours, p1 is replaced by the offspring and p2
+// is left intact. eaopt does not reset the fitness of the mate after a crossover, so
+// only the receiver may change.
+type CrossoverFunc func(p1, p2 Tour, rng *rand.Rand)
+
+// NewCrossover returns the crossover operator with the given name
+func NewCrossover(name string) (CrossoverFunc, error) {
+	switch name {
+	case CrossoverOX:
+		return CrossOX, nil
+	case CrossoverPMX:
+		return CrossPMX, nil
+	case CrossoverERX:
+		return CrossERX, nil
+	}
+	return nil, fmt.Errorf("unknown crossover `%s`, choose from %s, %s, %s",
+		name, CrossoverOX, CrossoverPMX, CrossoverERX)
+}
+
+// CrossOX applies order crossover. The offspring keeps a random segment of p1 in
+// place, the remaining tigs follow the order in p2, starting right after the segment.
+func CrossOX(p1, p2 Tour, rng *rand.Rand) {
+	p, q := randomTwoInts(p1, rng)
+	p1.Replace(p1.derive(orderCross(p1.Tigs, p2.Tigs, p, q)))
+}
+
+// orderCross makes an offspring with a[p..q] in place and the rest of the tigs in
+// the order of b
+func orderCross(a, b []Tig, p, q int) []Tig {
+	n := len(a)
+	o := make([]Tig, n)
+	inSegment := make(map[int]bool)
+	for i := p; i <= q; i++ {
+		o[i] = a[i]
+		inSegment[a[i].Idx] = true
+	}
+	j := (q + 1) % n
+	for k := 0; k < n; k++ {
+		t := b[(q+1+k)%n]
+		if inSegment[t.Idx] {
+			continue
+		}
+		o[j] = t
+		j = (j + 1) % n
+	}
+	return o
+}
+
+// CrossPMX applies partially mapped crossover. The offspring takes a random segment
+// from p1, the tigs outside the segment come from p2 at the same positions, unless
+// they conflict with the segment, in which case they are replaced following the
+// mapping defined by the segment.
+func CrossPMX(p1, p2 Tour, rng *rand.Rand) {
+	p, q := randomTwoInts(p1, rng)
+	p1.Replace(p1.derive(partiallyMappedCross(p1.Tigs, p2.Tigs, p, q)))
+}
+
+// partiallyMappedCross makes an offspring with a[p..q] in place and the rest of the
+// tigs from b
+func partiallyMappedCross(a, b []Tig, p, q int) []Tig {
+	n := len(a)
+	o := make([]Tig, n)
+	segmentPos := make(map[int]int) // Idx => position of the tig in a[p..q]
+	for i := p; i <= q; i++ {
+		o[i] = a[i]
+		segmentPos[a[i].Idx] = i
+	}
+	for i := 0; i < n; i++ {
+		if i >= p && i <= q {
+			continue
+		}
+		t := b[i]
+		for {
+			pos, ok := segmentPos[t.Idx]
+			if !ok {
+				break
+			}
+			t = b[pos]
+		}
+		o[i] = t
+	}
+	return o
+}
+
+// CrossERX applies edge recombination crossover. The offspring is built by walking
+// along the adjacencies found in either parent, preferring the neighbor that has the
+// fewest remaining adjacencies. The offspring starts from the first tig of p1 and
+// keeps the orientations of p1.
+func CrossERX(p1, p2 Tour, rng *rand.Rand) {
+	p1.Replace(p1.derive(edgeRecombinationCross(p1.Tigs, p2.Tigs, rng)))
+}
+
+// edgeRecombinationCross makes an offspring from the union of adjacencies in a and
+// b, the tigs are taken from a
+func edgeRecombinationCross(a, b []Tig, rng *rand.Rand) []Tig {
+	n := len(a)
+	tigs := make(map[int]Tig, n)        // Idx => tig in a
+	neighbors := make(map[int][]int, n) // Idx => adjacent tigs in a or b
+	addEdge := func(u, v int) {
+		for _, w := range neighbors[u] {
+			if w == v {
+				return
+			}
+		}
+		neighbors[u] = append(neighbors[u], v)
+		neighbors[v] = append(neighbors[v], u)
+	}
+	for _, t := range a {
+		tigs[t.Idx] = t
+	}
+	for _, parent := range [][]Tig{a, b} {
+		for i := 1; i < n; i++ {
+			addEdge(parent[i-1].Idx, parent[i].Idx)
+		}
+	}
+
+	// Tigs not yet in the offspring, kept as a set that supports random picks
+	remaining := make([]int, n)
+	remainingPos := make(map[int]int, n)
+	for i, t := range a {
+		remaining[i] = t.Idx
+		remainingPos[t.Idx] = i
+	}
+
+	o := make([]Tig, 0, n)
+	current := a[0].Idx
+	for {
+		o = append(o, tigs[current])
+		i := remainingPos[current]
+		last := remaining[len(remaining)-1]
+		remaining[i], remainingPos[last] = last, i
+		remaining = remaining[:len(remaining)-1]
+		delete(remainingPos, current)
+		if len(remaining) == 0 {
+			break
+		}
+		for _, u := range neighbors[current] {
+			neighbors[u] = removeInt(neighbors[u], current)
+		}
+
+		// Choose among the neighbors the one with the fewest neighbors, break ties
+		// at random
+		next, fewest, nties := -1, n+1, 0
+		for _, u := range neighbors[current] {
+			degree := len(neighbors[u])
+			if degree < fewest {
+				next, fewest, nties = u, degree, 1
+			} else if degree == fewest {
+				nties++
+				if rng.Intn(nties) == 0 {
+					next = u
+				}
+			}
+		}
+		if next == -1 { // Dead end, jump to a random tig
+			next = remaining[rng.Intn(len(remaining))]
+		}
+		current = next
+	}
+	return o
+}
+
+// removeInt removes the first occurrence of v from s
+func removeInt(s []int, v int) []int {
+	for i, w := range s {
+		if w == v {
+			return append(s[:i], s[i+1:]...)
+		}
+	}
+	return s
+}
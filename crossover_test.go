@@ -0,0 +1,74 @@
+/*
+ *  crossover_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/18/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// makeTour builds a tour of n tigs in random order and orientations
+func makeTour(n int, rng *rand.Rand) allhic.Tour {
+	tour := allhic.Tour{Tigs: make([]allhic.Tig, n)}
+	for i, idx := range rng.Perm(n) {
+		sign := byte('+')
+		if rng.Intn(2) == 0 {
+			sign = '-'
+		}
+		tour.Tigs[i] = allhic.Tig{Idx: idx, Size: 1000 + idx, Sign: sign}
+	}
+	return tour
+}
+
+func TestCrossover(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	for _, name := range []string{allhic.CrossoverOX, allhic.CrossoverPMX, allhic.CrossoverERX} {
+		cross, err := allhic.NewCrossover(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 100; i++ {
+			p1, p2 := makeTour(20, rng), makeTour(20, rng)
+			parents := make(map[allhic.Tig]bool)
+			for j := range p1.Tigs {
+				parents[p1.Tigs[j]] = true
+				parents[p2.Tigs[j]] = true
+			}
+			mate := append([]allhic.Tig{}, p2.Tigs...)
+			cross(p1, p2, rng)
+
+			// The offspring must be a permutation of the tigs, and each tig comes
+			// from one of the parents with its orientation
+			seen := make(map[int]bool)
+			for _, tig := range p1.Tigs {
+				if seen[tig.Idx] {
+					t.Fatalf("%s: tig %d appears twice in %v", name, tig.Idx, p1.Tigs)
+				}
+				seen[tig.Idx] = true
+				if !parents[tig] {
+					t.Fatalf("%s: tig %v not found in parents", name, tig)
+				}
+			}
+			if len(seen) != 20 {
+				t.Fatalf("%s: expected 20 tigs, got %d", name, len(seen))
+			}
+			// The mate is left intact
+			for j := range mate {
+				if p2.Tigs[j] != mate[j] {
+					t.Fatalf("%s: mate changed at %d", name, j)
+				}
+			}
+		}
+	}
+	if _, err := allhic.NewCrossover("cx"); err == nil {
+		t.Fatal("Expected error for unknown crossover")
+	}
+}
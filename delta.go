@@ -0,0 +1,288 @@
+/*
+ *  delta.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/18/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"math"
+	"math/rand"
+)
+
+// All the scores are sums over pairs of tigs, and a mutation typically only
+// changes the distances of the pairs that have at least one tig within a segment
+// [p, q]. Pairs that span across the segment are unchanged since the total size of
+// the segment is unchanged. Therefore we only need to recompute the pairs between the
+// segment and its flanks (up to the limit), plus the pairs within the segment that
+// change their relative positions. Tour.Evaluate remains the reference.
+
+// resyncDeltas is the number of deltas applied to a cached score before it is
+// evaluated in full again, so that the rounding errors do not add up
+const resyncDeltas = 100
+
+// tourCache holds the score of a tour so that mutations can update it with a delta
+type tourCache struct {
+	score  float64
+	valid  bool
+	deltas int // Deltas applied since the last full evaluation
+}
+
+// pairScorer is implemented by scorers that are sums over pairs of tigs, tig a is
+// to the left of tig b, and gap is the total size of all tigs in between
+type pairScorer interface {
+	pairScore(tour Tour, a, b Tig, gap int) float64
+}
+
+// Kinds of mutations applied in Tour.Mutate
+const (
+	mutFlip = iota
+	mutPermute
+	mutSplice
+	mutInsertion
+	mutInversion
+)
+
+// pairScore is the contribution of a single pair to Tour.EvaluateSumRecip
+func (r RecipScorer) pairScore(tour Tour, a, b Tig, gap int) float64 {
+	dist := float64(gap) + float64(a.Size+b.Size)/2
+	if dist > float64(tour.Limit) {
+		return 0
+	}
+	return -float64(tour.M[a.Idx][b.Idx]) / dist
+}
+
+// pairScore is the contribution of a single pair to Tour.EvaluateSumLog
+func (r SumLogScorer) pairScore(tour Tour, a, b Tig, gap int) float64 {
+	dist := float64(gap) + float64(a.Size+b.Size)/2
+	limit := float64(tour.Limit)
+	if dist > limit {
+		return 0
+	}
+	return float64(tour.M[a.Idx][b.Idx]) * (math.Log(dist) - math.Log(limit))
+}
+
+// pairScore is the contribution of a single pair to LikelihoodScorer.Score
+func (r *LikelihoodScorer) pairScore(tour Tour, a, b Tig, gap int) float64 {
+	dist := float64(gap) + float64(a.Size+b.Size)/2
+	nlinks := tour.M[a.Idx][b.Idx]
+	if dist > float64(tour.Limit) || nlinks == 0 {
+		return 0
+	}
+	return float64(nlinks) * (r.logProb(tour.Limit) - r.logProb(int(dist)))
+}
+
+// pairScore is the contribution of a single pair to MLScorer.Score
+func (r *MLScorer) pairScore(tour Tour, a, b Tig, gap int) float64 {
+	if gap > tour.Limit || tour.M[a.Idx][b.Idx] == 0 {
+		return 0
+	}
+	gdists, ok := r.clm.orientedContacts[OrientedPair{a.Idx, b.Idx, a.Sign, b.Sign}]
+	if !ok {
+		return 0
+	}
+	limitLogProb := r.logProb(tour.Limit)
+	score := 0.0
+	for k := 0; k < BB; k++ {
+		if gdists[k] == 0 {
+			continue
+		}
+		link := min(GR[k]+gap, tour.Limit)
+		score += float64(gdists[k]) * (limitLogProb - r.logProb(link))
+	}
+	return score
+}
+
+// pairScorer returns the scorer as a pairScorer if it supports delta evaluation
+func (r Tour) pairScorer() (pairScorer, bool) {
+	s, ok := r.scorer().(pairScorer)
+	return s, ok
+}
+
+// cached tells if the tour holds a valid score to apply deltas to
+func (r Tour) cached() bool {
+	return r.cache != nil && r.cache.valid
+}
+
+// invalidate marks the cached score as stale after the tour is changed
+func (r Tour) invalidate() {
+	if r.cache != nil {
+		r.cache.valid = false
+	}
+}
+
+// starts computes the start position of every tig in the tour
+func (r Tour) starts() []int {
+	starts := make([]int, r.Len())
+	cumSum := 0
+	for i, t := range r.Tigs {
+		starts[i] = cumSum
+		cumSum += t.Size
+	}
+	return starts
+}
+
+// updateStarts recomputes the start positions within [p, q] after a mutation,
+// positions outside the segment are unchanged
+func (r Tour) updateStarts(starts []int, p, q int) {
+	for i := p + 1; i <= q; i++ {
+		starts[i] = starts[i-1] + r.Tigs[i-1].Size
+	}
+}
+
+// pairsAround sums the scores between the i-th tig and the tigs within [lo, hi],
+// walking away from i so that we stop once the gap exceeds the limit
+func (r Tour) pairsAround(s pairScorer, starts []int, i, lo, hi int) float64 {
+	score := 0.0
+	ti := r.Tigs[i]
+	for j := min(i-1, hi); j >= lo; j-- {
+		tj := r.Tigs[j]
+		gap := starts[i] - starts[j] - tj.Size
+		if gap > r.Limit {
+			break
+		}
+		score += s.pairScore(r, tj, ti, gap)
+	}
+	for j := max(i+1, lo); j <= hi; j++ {
+		tj := r.Tigs[j]
+		gap := starts[j] - starts[i] - ti.Size
+		if gap > r.Limit {
+			break
+		}
+		score += s.pairScore(r, ti, tj, gap)
+	}
+	return score
+}
+
+// flankScore sums the scores of all pairs between the segment [p, q] and the tigs
+// outside of the segment
+func (r Tour) flankScore(s pairScorer, starts []int, p, q int) float64 {
+	score := 0.0
+	n := r.Len()
+	for i := p; i <= q; i++ {
+		score += r.pairsAround(s, starts, i, 0, p-1)
+		score += r.pairsAround(s, starts, i, q+1, n-1)
+	}
+	return score
+}
+
+// MutInversionDelta reverses the segment [p, q] and returns the change in score.
+// Pairs within the segment keep their distances (and flip their orientations
+// together), so only the flanks are recomputed. As in invert, a single tig is
+// flipped if the tour is oriented.
+func (r Tour) MutInversionDelta(p, q int) float64 {
+	s, ok := r.pairScorer()
+	if p > q {
+		p, q = q, p
+	}
+	if !ok {
+		return r.fullDelta(func() { invert(r, p, q) })
+	}
+	starts := r.starts()
+	before := r.flankScore(s, starts, p, q)
+	invert(r, p, q)
+	r.updateStarts(starts, p, q)
+	return r.flankScore(s, starts, p, q) - before
+}
+
+// MutInsertionDelta moves the tig at q to p (toFront) or the tig at p to q, where
+// p < q, and returns the change in score. Pairs among the shifted tigs keep their
+// distances.
+func (r Tour) MutInsertionDelta(p, q int, toFront bool) float64 {
+	s, ok := r.pairScorer()
+	if p == q {
+		return 0
+	}
+	if !ok {
+		return r.fullDelta(func() { insert(r, p, q, toFront) })
+	}
+	from, to := p, q
+	if toFront {
+		from, to = q, p
+	}
+	starts := r.starts()
+	before := r.flankScore(s, starts, p, q) + r.pairsAround(s, starts, from, p, q)
+	insert(r, p, q, toFront)
+	r.updateStarts(starts, p, q)
+	return r.flankScore(s, starts, p, q) + r.pairsAround(s, starts, to, p, q) - before
+}
+
+// MutPermuteDelta swaps the tigs at p and q, and returns the change in score. Tigs
+// in between may shift, so their flanks are recomputed as well.
+func (r Tour) MutPermuteDelta(p, q int) float64 {
+	s, ok := r.pairScorer()
+	if p == q {
+		return 0
+	}
+	if !ok {
+		return r.fullDelta(func() { r.Swap(p, q) })
+	}
+	if p > q {
+		p, q = q, p
+	}
+	inner := func(starts []int) float64 {
+		return r.flankScore(s, starts, p, q) +
+			r.pairsAround(s, starts, p, p+1, q) + r.pairsAround(s, starts, q, p+1, q-1)
+	}
+	starts := r.starts()
+	before := inner(starts)
+	r.Swap(p, q)
+	r.updateStarts(starts, p, q)
+	return inner(starts) - before
+}
+
+// MutFlipDelta reverses the orientation of the i-th tig and returns the change in score
+func (r Tour) MutFlipDelta(i int) float64 {
+	s, ok := r.pairScorer()
+	if !ok {
+		return r.fullDelta(func() { r.Flip(i) })
+	}
+	starts := r.starts()
+	before := r.flankScore(s, starts, i, i)
+	r.Flip(i)
+	return r.flankScore(s, starts, i, i) - before
+}
+
+// fullDelta is the fallback when a mutation cannot be scored incrementally, the
+// tour is evaluated in full before and after the mutation
+func (r Tour) fullDelta(mutate func()) float64 {
+	before, _ := r.scorer().Score(r)
+	mutate()
+	after, _ := r.scorer().Score(r)
+	return after - before
+}
+
+// mutateDelta applies the same mutations as mutate, drawing the same random numbers,
+// but returns the change in score instead of leaving the score to be re-evaluated
+func (r Tour) mutateDelta(rng *rand.Rand) float64 {
+	switch r.pickMutation(rng) {
+	case mutFlip:
+		return r.MutFlipDelta(rng.Intn(r.Len()))
+	case mutPermute:
+		if r.Len() <= 1 {
+			return 0
+		}
+		p, q := randomTwoInts(r, rng)
+		return r.MutPermuteDelta(p, q)
+	case mutSplice:
+		old := r.cache.score
+		MutSplice(r, rng)
+		score, _ := r.scorer().Score(r)
+		return score - old
+	case mutInsertion:
+		p, q := randomTwoInts(r, rng)
+		if p == q {
+			return 0
+		}
+		return r.MutInsertionDelta(p, q, rng.Float64() < .5)
+	default:
+		p, q := randomTwoInts(r, rng)
+		if p == q {
+			return 0
+		}
+		return r.MutInversionDelta(p, q)
+	}
+}
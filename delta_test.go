@@ -0,0 +1,118 @@
+/*
+ *  delta_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/18/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// writeTestDistribution writes a power law link size distribution for the
+// likelihood scorers, in the geometric bins of extract from MinLinkDist to MaxLinkDist
+func writeTestDistribution(t *testing.T) string {
+	distfile := path.Join(t.TempDir(), "test.distribution.txt")
+	f, err := os.Create(distfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fmt.Fprint(f, allhic.DistributionHeader)
+	var binStarts []int
+	for start := allhic.MinLinkDist; start < allhic.MaxLinkDist; start *= 2 {
+		for j := 0; j < 16; j++ {
+			binStarts = append(binStarts, int(float64(start)*math.Pow(allhic.GeometricBinSize, float64(j))))
+		}
+	}
+	binStarts = append(binStarts, allhic.MaxLinkDist)
+	for i := 0; i+1 < len(binStarts); i++ {
+		fmt.Fprintf(f, "%d\t%d\t%d\t%d\t%d\t%.4g\n", i, binStarts[i],
+			binStarts[i+1]-binStarts[i], 100, 1000000, 0.1/float64(binStarts[i]))
+	}
+	return distfile
+}
+
+// checkScore compares the score of a tour against a full evaluation
+func checkScore(t *testing.T, name string, got float64, tour allhic.Tour) {
+	expected, _ := tour.Scorer.Score(tour)
+	if math.Abs(got-expected) > 1e-6*math.Max(1, math.Abs(expected)) {
+		t.Fatalf("%s: expected score %.6f, got %.6f", name, expected, got)
+	}
+}
+
+func TestMutationDelta(t *testing.T) {
+	distfile := writeTestDistribution(t)
+	for _, score := range []string{allhic.ScoreRecip, allhic.ScoreSumLog,
+		allhic.ScoreLikelihood, allhic.ScoreML} {
+		rng := rand.New(rand.NewSource(42))
+		clm := allhic.NewCLM(path.Join("tests", "simulation", "test.clm"),
+			path.Join("tests", "simulation", "test.ids"))
+		scorer, err := allhic.NewScorer(score, distfile, clm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clm.Tour.Limit = allhic.LIMIT
+		clm.Tour.Scorer = scorer
+		clm.Activate(true, rng)
+		tour := clm.Tour
+
+		// Each delta should match the difference between two full evaluations
+		for i := 0; i < 200; i++ {
+			p, q := rng.Intn(tour.Len()), rng.Intn(tour.Len())
+			before, _ := tour.Evaluate()
+			var delta float64
+			switch i % 4 {
+			case 0:
+				delta = tour.MutInversionDelta(p, q)
+			case 1:
+				if p > q {
+					p, q = q, p
+				}
+				delta = tour.MutInsertionDelta(p, q, rng.Intn(2) == 0)
+			case 2:
+				delta = tour.MutPermuteDelta(p, q)
+			default:
+				delta = tour.MutFlipDelta(p)
+			}
+			checkScore(t, score, before+delta, tour)
+		}
+
+		// The score kept up to date in Mutate should match a full evaluation
+		genome := tour.Clone().(allhic.Tour)
+		for i := 0; i < 200; i++ {
+			genome.Mutate(rng)
+			got, _ := genome.Evaluate()
+			checkScore(t, score, got, genome)
+		}
+	}
+}
+
+func TestMutateNoDrift(t *testing.T) {
+	distfile := writeTestDistribution(t)
+	for _, score := range []string{allhic.ScoreRecip, allhic.ScoreML} {
+		rng := rand.New(rand.NewSource(42))
+		genome := newScoredCLM(t, path.Join("tests", "simulation", "test.ids"), score,
+			distfile).Tour.Clone().(allhic.Tour)
+		// Many deltas in a row, the cached score stays close to a full evaluation
+		for i := 0; i < 5000; i++ {
+			genome.Mutate(rng)
+			got, _ := genome.Evaluate()
+			expected, _ := genome.Scorer.Score(genome)
+			if math.Abs(got-expected) > 1e-12*math.Max(1, math.Abs(expected)) {
+				t.Fatalf("%s: cached score %.12f drifted from %.12f after %d mutations",
+					score, got, expected, i+1)
+			}
+		}
+	}
+}
@@ -10,6 +10,7 @@
 package allhic
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"math/rand"
@@ -18,10 +19,13 @@ import (
 	"github.com/MaxHalford/eaopt"
 )
 
-// LIMIT determines the largest distance for two tigs to add to total score
+// LIMIT is the default largest distance for two tigs to add to total score
 const LIMIT = 10000000
 
 // LimitLog is the Log of LIMIT
+//
+// Deprecated: the limit is set per tour by Optimizer.Limit, LimitLog only holds
+// the Log of the default.
 var LimitLog = math.Log(LIMIT)
 
 // We will implement the Slice interface here, key ideas borrowed from:
@@ -35,6 +39,7 @@ func (r Tour) At(i int) interface{} {
 // Set method from Slice
 func (r Tour) Set(i int, v interface{}) {
 	r.Tigs[i] = v.(Tig)
+	r.invalidate()
 }
 
 // Len method from Slice
@@ -45,40 +50,90 @@ func (r Tour) Len() int {
 // Swap method from Slice
 func (r Tour) Swap(i, j int) {
 	r.Tigs[i], r.Tigs[j] = r.Tigs[j], r.Tigs[i]
+	r.invalidate()
 }
 
 // Slice method from Slice
 func (r Tour) Slice(a, b int) eaopt.Slice {
-	return Tour{r.Tigs[a:b], r.M}
+	return r.derive(r.Tigs[a:b])
 }
 
 // Split method from Slice
 func (r Tour) Split(k int) (eaopt.Slice, eaopt.Slice) {
-	return Tour{r.Tigs[:k], r.M}, Tour{r.Tigs[k:], r.M}
+	return r.derive(r.Tigs[:k]), r.derive(r.Tigs[k:])
 }
 
 // Append method from Slice
 func (r Tour) Append(q eaopt.Slice) eaopt.Slice {
-	return Tour{append(r.Tigs, q.(Tour).Tigs...), r.M}
+	return r.derive(append(r.Tigs, q.(Tour).Tigs...))
 }
 
 // Replace method from Slice
 func (r Tour) Replace(q eaopt.Slice) {
 	copy(r.Tigs, q.(Tour).Tigs)
+	r.invalidate()
 }
 
-// Copy method from Slice
+// Copy method from Slice, the copy gets its own score cache
 func (r Tour) Copy() eaopt.Slice {
-	var clone Tour
-	clone.Tigs = make([]Tig, r.Len())
-	copy(clone.Tigs, r.Tigs)
-	clone.M = r.M
+	tigs := make([]Tig, r.Len())
+	copy(tigs, r.Tigs)
+	clone := r.derive(tigs)
+	clone.cache = new(tourCache)
+	if r.cache != nil {
+		*clone.cache = *r.cache
+	}
 	return clone
 }
 
+// Signs returns a copy of the orientations of all tigs in the tour
+func (r Tour) Signs() []byte {
+	signs := make([]byte, r.Len())
+	for i, t := range r.Tigs {
+		signs[i] = t.Sign
+	}
+	return signs
+}
+
+// SetSigns sets the orientations of all tigs in the tour
+func (r Tour) SetSigns(signs []byte) {
+	for i := range r.Tigs {
+		r.Tigs[i].Sign = signs[i]
+	}
+	r.invalidate()
+}
+
+// Flip reverses the orientation of the i-th tig
+func (r Tour) Flip(i int) {
+	r.Tigs[i].Sign = rr(r.Tigs[i].Sign)
+	r.invalidate()
+}
+
+// oriented tells if the scorer accounts for orientations, in which case the
+// orientations are evolved together with the ordering in GA
+func (r Tour) oriented() bool {
+	_, ok := r.Scorer.(orientationAware)
+	return ok
+}
+
+// derive makes a Tour with the given tigs that shares the evaluation settings of r,
+// the score is not cached
+func (r Tour) derive(tigs []Tig) Tour {
+	r.Tigs = tigs
+	r.cache = nil
+	return r
+}
+
+// scorer returns the Scorer of the tour, defaults to RecipScorer
+func (r Tour) scorer() Scorer {
+	if r.Scorer == nil {
+		return RecipScorer{}
+	}
+	return r.Scorer
+}
+
 // EvaluateSumLog calculates a score for the current tour
 func (r Tour) EvaluateSumLog() (float64, error) {
-	//func (r Tour) Evaluate() (float64, error) {
 	size := r.Len()
 	mid := make([]float64, size)
 	cumSum := 0.0
@@ -88,6 +143,8 @@ func (r Tour) EvaluateSumLog() (float64, error) {
 		cumSum += tsize
 	}
 
+	limit := float64(r.Limit)
+	limitLog := math.Log(limit)
 	score := 0.0
 	// Now add up all the pairwise scores
 	for i := 0; i < size; i++ {
@@ -100,21 +157,34 @@ func (r Tour) EvaluateSumLog() (float64, error) {
 			// 1. Break earlier reduces the amount of calculation
 			// 2. Ignore distant links so that telomeric regions don't come
 			//    to be adjacent (based on Ler0 data)
-			if dist > LIMIT {
+			if dist > limit {
 				break
 			}
 			// eaopt only looks at minimum =>
 			// everytime we have a small dist, we reduce the total score
 			// we are looking at the largest reductions from all links
-			score += float64(nlinks) * (math.Log(dist) - LimitLog)
+			score += float64(nlinks) * (math.Log(dist) - limitLog)
 		}
 	}
 	return score, nil
 }
 
-// Evaluate calculates a score for the current tour
+// Evaluate calculates a score for the current tour with the chosen Scorer,
+// defaults to EvaluateSumRecip. The score is cached so that GA mutations can update
+// it incrementally, see delta.go
 func (r Tour) Evaluate() (float64, error) {
-	//func (r Tour) EvaluateSumRecip() (float64, error) {
+	if r.cached() {
+		return r.cache.score, nil
+	}
+	score, err := r.scorer().Score(r)
+	if err == nil && r.cache != nil {
+		r.cache.score, r.cache.valid, r.cache.deltas = score, true, 0
+	}
+	return score, err
+}
+
+// EvaluateSumRecip calculates a score for the current tour
+func (r Tour) EvaluateSumRecip() (float64, error) {
 	size := r.Len()
 	mid := make([]float64, size)
 	cumSum := 0.0
@@ -124,6 +194,7 @@ func (r Tour) Evaluate() (float64, error) {
 		cumSum += tsize
 	}
 
+	limit := float64(r.Limit)
 	score := 0.0
 	// Now add up all the pairwise scores
 	for i := 0; i < size; i++ {
@@ -132,7 +203,7 @@ func (r Tour) Evaluate() (float64, error) {
 			b := r.Tigs[j].Idx
 			nlinks := r.M[a][b]
 			dist := mid[j] - mid[i]
-			if dist > LIMIT {
+			if dist > limit {
 				break
 			}
 			// We are looking for maximum
@@ -161,11 +232,22 @@ func MutInversion(genome eaopt.Slice, rng *rand.Rand) {
 	if p == q {
 		return
 	}
+	invert(genome, p, q)
+	// log.Debugf("After MutInversion: %v", genome)
+}
+
+// invert reverses the segment [p, q] of the genome
+func invert(genome eaopt.Slice, p, q int) {
 	// Swap within range
 	for i, j := p, q; i < j; i, j = i+1, j-1 {
 		genome.Swap(i, j)
 	}
-	// log.Debugf("After MutInversion: %v", genome)
+	// Reversing a segment also reverses the orientations of the tigs within
+	if tour, ok := genome.(Tour); ok && tour.oriented() {
+		for i := p; i <= q; i++ {
+			tour.Flip(i)
+		}
+	}
 }
 
 // MutInsertion applies insertion operation on the genome
@@ -176,8 +258,13 @@ func MutInsertion(genome eaopt.Slice, rng *rand.Rand) {
 	if p == q {
 		return
 	}
+	insert(genome, p, q, rng.Float64() < .5)
+	// log.Debugf("After MutInsertion: %v", genome)
+}
 
-	if rng.Float64() < .5 {
+// insert moves the gene at q to p (toFront) or the gene at p to q, where p < q
+func insert(genome eaopt.Slice, p, q int, toFront bool) {
+	if toFront {
 		cq := genome.At(q) // Pop q and insert to p position
 		// Move cq to the front and push everyone right
 		for i := q; i > p; i-- {
@@ -192,8 +279,6 @@ func MutInsertion(genome eaopt.Slice, rng *rand.Rand) {
 		}
 		genome.Set(q, cp)
 	}
-
-	// log.Debugf("After MutInsertion: %v", genome)
 }
 
 // MutPermute permutes two genes at random n times
@@ -217,31 +302,78 @@ func MutSplice(genome eaopt.Slice, rng *rand.Rand) {
 	genome.Replace(b.Append(a))
 }
 
-// Mutate a Tour by applying by inversion or insertion
+// MutFlip reverses the orientation of a single tig
+func MutFlip(genome eaopt.Slice, rng *rand.Rand) {
+	if tour, ok := genome.(Tour); ok {
+		tour.Flip(rng.Intn(tour.Len()))
+	}
+}
+
+// Mutate a Tour by applying by inversion or insertion, and flipping when the
+// orientations are evolved as well. If the tour holds a valid score, the score is
+// updated with the delta rather than evaluated again, except every resyncDeltas
+// mutations.
 func (r Tour) Mutate(rng *rand.Rand) {
+	if r.cached() {
+		score := r.cache.score + r.mutateDelta(rng)
+		r.cache.score, r.cache.valid = score, true
+		r.cache.deltas++
+		if r.cache.deltas >= resyncDeltas {
+			r.invalidate()
+		}
+		return
+	}
+	r.mutate(rng)
+}
+
+// pickMutation chooses the kind of mutation to apply
+func (r Tour) pickMutation(rng *rand.Rand) int {
+	if r.oriented() && rng.Float64() < .2 {
+		return mutFlip
+	}
 	rd := rng.Float64()
 	if rd < 0.2 {
-		MutPermute(r, rng)
+		return mutPermute
 	} else if rd < .4 {
-		MutSplice(r, rng)
+		return mutSplice
 	} else if rd < .7 {
+		return mutInsertion
+	}
+	return mutInversion
+}
+
+// mutate applies a random mutation without keeping track of the score
+func (r Tour) mutate(rng *rand.Rand) {
+	switch r.pickMutation(rng) {
+	case mutFlip:
+		MutFlip(r, rng)
+	case mutPermute:
+		MutPermute(r, rng)
+	case mutSplice:
+		MutSplice(r, rng)
+	case mutInsertion:
 		MutInsertion(r, rng)
-	} else {
+	default:
 		MutInversion(r, rng)
 	}
 }
 
-// Crossover a Tour with another Tour by using Partially Mixed Crossover (PMX).
-func (r Tour) Crossover(_ eaopt.Genome, _ *rand.Rand) {
+// Crossover a Tour with another Tour, defaults to order crossover (OX). See
+// crossover.go for the available operators.
+func (r Tour) Crossover(q eaopt.Genome, rng *rand.Rand) {
+	if r.Len() < 2 {
+		return
+	}
+	cross := r.Cross
+	if cross == nil {
+		cross = CrossOX
+	}
+	cross(r, q.(Tour), rng)
 }
 
 // Clone a Tour
 func (r Tour) Clone() eaopt.Genome {
-	var clone Tour
-	clone.Tigs = make([]Tig, r.Len())
-	copy(clone.Tigs, r.Tigs)
-	clone.M = r.M
-	return clone
+	return r.Copy().(Tour)
 }
 
 // Shuffle randomly shuffles an integer array using Knuth or Fisher-Yates
@@ -252,6 +384,34 @@ func (r Tour) Shuffle(rng *rand.Rand) {
 		j := i + rng.Intn(N-i)
 		r.Tigs[j], r.Tigs[i] = r.Tigs[i], r.Tigs[j]
 	}
+	r.invalidate()
+}
+
+// MigBest sends copies of the best tours of each island to the next island in a
+// ring, where they replace the worst tours. Unlike eaopt.MigRing, the good tours
+// spread to the other islands rather than being swapped at random.
+type MigBest struct {
+	NMigrants uint // Number of tours sent to the next island
+}
+
+// Apply MigBest, the individuals are sorted by fitness after every generation
+func (mig MigBest) Apply(pops eaopt.Populations, rng *rand.Rand) {
+	migrants := make([]eaopt.Individuals, len(pops))
+	for i, pop := range pops {
+		migrants[i] = pop.Individuals[:mig.NMigrants].Clone(rng)
+	}
+	for i := range pops {
+		dest := pops[(i+1)%len(pops)].Individuals
+		copy(dest[len(dest)-len(migrants[i]):], migrants[i])
+	}
+}
+
+// Validate MigBest fields
+func (mig MigBest) Validate() error {
+	if mig.NMigrants == 0 {
+		return errors.New("NMigrants should be higher than 0")
+	}
+	return nil
 }
 
 // GARun set up the Genetic Algorithm and run it
@@ -266,16 +426,29 @@ func (r *CLM) GARun(fwtour *os.File, opt *Optimizer, phase int) Tour {
 		panic(err)
 	}
 
-	ga.NPops = 1
-	ga.NGenerations = 1000000
+	ga.NPops = uint(opt.NIslands)
+	if opt.NIslands > 1 {
+		ga.Migrator = MigBest{NMigrants: uint(opt.NMigrants)}
+		ga.MigFrequency = uint(opt.MigFrequency)
+	}
+	ga.NGenerations = uint(opt.MaxGen)
 	ga.PopSize = uint(opt.NPop)
 	ga.Model = eaopt.ModGenerational{
 		Selector: eaopt.SelTournament{
-			NContestants: 3,
+			NContestants: uint(opt.NContestants),
 		},
-		MutRate: opt.MutProb,
+		MutRate:   opt.MutProb,
+		CrossRate: opt.CrossProb,
 	}
-	ga.RNG = opt.rng
+	// The results only depend on the seed, regardless of the number of cores:
+	// - Each phase draws from its own RNG seeded from opt.Seed, and eaopt gives every
+	//   island an RNG seeded from this one, which is the one passed to Mutate and
+	//   Crossover. Islands and evaluations may run in parallel, but they never share
+	//   an RNG.
+	// - Evaluate only reads the shared data (M, contacts, link model) and only writes
+	//   to the score cache owned by that tour, so parallel evaluation gives the same
+	//   fitness as a sequential one.
+	ga.RNG = rand.New(rand.NewSource(opt.Seed + int64(phase)))
 	ga.ParallelEval = true
 
 	best := new(float64)
@@ -305,8 +478,9 @@ func (r *CLM) GARun(fwtour *os.File, opt *Optimizer, phase int) Tour {
 		return ga.Generations-*updated > uint(opt.NGen)
 	}
 
-	log.Noticef("GA initialized (npop: %v, ngen: %v, mu: %.2f, rng: %d, break: %d)",
-		opt.NPop, opt.NGen, opt.MutProb, opt.Seed, LIMIT)
+	log.Noticef("GA initialized (npop: %v, ngen: %v, mu: %.2f, cx: %.2f (%s), rng: %d, break: %d, tournament: %d, maxgen: %d, islands: %d, migfreq: %d, migrants: %d, oriented: %v)",
+		opt.NPop, opt.NGen, opt.MutProb, opt.CrossProb, opt.Crossover, opt.Seed, opt.Limit,
+		opt.NContestants, opt.MaxGen, opt.NIslands, opt.MigFrequency, opt.NMigrants, r.Tour.oriented())
 
 	_ = ga.Minimize(MakeTour)
 
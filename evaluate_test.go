@@ -0,0 +1,126 @@
+/*
+ *  evaluate_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/18/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"math/rand"
+	"path"
+	"testing"
+
+	"github.com/MaxHalford/eaopt"
+	"github.com/tanghaibao/allhic"
+)
+
+// newOrientedTour loads the simulation into a tour scored by the ML scorer, in the
+// order of the tigs in the ids file
+func newOrientedTour(t *testing.T) allhic.Tour {
+	clm := allhic.NewCLM(path.Join("tests", "simulation", "test.clm"),
+		path.Join("tests", "simulation", "test.ids"))
+	scorer, err := allhic.NewScorer(allhic.ScoreML, writeTestDistribution(t), clm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clm.Tour.Limit = allhic.LIMIT
+	clm.Tour.Scorer = scorer
+	clm.Activate(false, rand.New(rand.NewSource(42)))
+	return clm.Tour
+}
+
+func TestMutInversionFlipsSigns(t *testing.T) {
+	tour := newOrientedTour(t)
+	rng := rand.New(rand.NewSource(42))
+	for k := 0; k < 20; k++ {
+		before := make([]allhic.Tig, tour.Len())
+		copy(before, tour.Tigs)
+		allhic.MutInversion(tour, rng)
+
+		// The segment is between the first and the last tigs that moved
+		p, q := -1, -1
+		for i, tig := range tour.Tigs {
+			if tig.Idx != before[i].Idx {
+				if p == -1 {
+					p = i
+				}
+				q = i
+			}
+		}
+		for i, tig := range tour.Tigs {
+			if p <= i && i <= q {
+				old := before[p+q-i]
+				if tig.Idx != old.Idx || tig.Sign == old.Sign {
+					t.Fatalf("Expected %v reversed and flipped at %d in [%d, %d], got %v",
+						old, i, p, q, tig)
+				}
+			} else if tig != before[i] {
+				t.Fatalf("Expected %v unchanged at %d outside [%d, %d], got %v",
+					before[i], i, p, q, tig)
+			}
+		}
+	}
+}
+
+func TestGAEvolvesSigns(t *testing.T) {
+	tour := newOrientedTour(t)
+	p := allhic.Optimizer{REfile: copyREfile(t),
+		Clmfile: path.Join("tests", "simulation", "test.clm"),
+		RunGA:   true, Seed: 42, NPop: 20, NGen: 50, MutProb: .2,
+		Score: allhic.ScoreML, Distfile: writeTestDistribution(t)}
+	p.Run()
+	tf, err := allhic.ReadTourFile(p.OutTourFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, last := tf.Records[0], tf.Records[len(tf.Records)-1]
+	if first.Label != "INIT" || last.Label == "INIT" || len(first.Contigs) != tour.Len() {
+		t.Fatalf("Expected the INIT tour followed by the GA tours, got %s and %s",
+			first.Label, last.Label)
+	}
+	signs := make(map[string]byte)
+	for _, c := range first.Contigs {
+		signs[c.Name] = c.Sign
+	}
+	changed := 0
+	for _, c := range last.Contigs {
+		if c.Sign != signs[c.Name] {
+			changed++
+		}
+	}
+	if changed == 0 {
+		t.Fatalf("Expected GA to change some of the signs from INIT to %s", last.Label)
+	}
+	for _, record := range tf.Records {
+		if record.Label[:4] == "FLIP" {
+			t.Fatalf("Expected no flipping phases with score %s, got %s", p.Score, record.Label)
+		}
+	}
+}
+
+func TestMigBest(t *testing.T) {
+	// Each island is sorted from the best, the fitness tells the island and the rank
+	const nIslands, popSize = 3, 5
+	pops := make(eaopt.Populations, nIslands)
+	for i := range pops {
+		pops[i].Individuals = make(eaopt.Individuals, popSize)
+		for j := range pops[i].Individuals {
+			pops[i].Individuals[j].Fitness = float64(10*i + j)
+		}
+	}
+	allhic.MigBest{NMigrants: 2}.Apply(pops, rand.New(rand.NewSource(42)))
+
+	for i, pop := range pops {
+		prev := (i + nIslands - 1) % nIslands
+		expected := []float64{float64(10 * i), float64(10*i + 1), float64(10*i + 2),
+			float64(10 * prev), float64(10*prev + 1)}
+		for j, indi := range pop.Individuals {
+			if indi.Fitness != expected[j] {
+				t.Fatalf("Island %d: expected fitness %v, got %v at %d", i, expected, indi.Fitness, j)
+			}
+		}
+	}
+}
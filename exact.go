@@ -0,0 +1,278 @@
+/*
+ *  exact.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/18/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+)
+
+// Exact solver for small groups. The score of a pair depends on the sizes of all the
+// tigs in between, so the problem does not decompose as in Held-Karp. Instead we do a
+// branch-and-bound that places the tigs from left to right. The pairs within the
+// placed prefix are scored exactly, while the remaining pairs are bounded from below
+// by their best possible score given the smallest gap they could have. A tour and its
+// reverse are the same, so once the first tig is placed, the last tig is picked among
+// those with a larger idx and kept until the end.
+
+// exactMaxNodes caps the search, above which the best tour found is not proven optimal
+const exactMaxNodes = 10000000
+
+// pairBounder is implemented by the scorers that can bound the score of a pair
+type pairBounder interface {
+	pairScorer
+	// pairBound is a lower bound of pairScore for all gaps of at least minGap, and
+	// for all orientations of b (and of a if freeA) when the tour is oriented
+	pairBound(tour Tour, a, b Tig, minGap int, freeA bool) float64
+}
+
+// pairBound for RecipScorer, the score only gets worse with larger gaps
+func (r RecipScorer) pairBound(tour Tour, a, b Tig, minGap int, _ bool) float64 {
+	return r.pairScore(tour, a, b, minGap)
+}
+
+// pairBound for SumLogScorer, the score only gets worse with larger gaps
+func (r SumLogScorer) pairBound(tour Tour, a, b Tig, minGap int, _ bool) float64 {
+	return r.pairScore(tour, a, b, minGap)
+}
+
+// maxLogProb is an upper bound of logProb for all link sizes from dist onwards
+func (r *LikelihoodScorer) maxLogProb(dist int) float64 {
+	tail := math.Inf(1) // Beyond the last bin, the power law only decreases if B < 0
+	if r.model.B < 0 {
+		tail = math.Log(r.model.transformPowerLaw(max(dist, 1)))
+	}
+	bin := r.model.linkBin(dist)
+	if bin < 0 {
+		bin = 0
+	}
+	if bin >= len(r.maxLogDensity) {
+		return tail
+	}
+	return math.Max(r.maxLogDensity[bin], tail)
+}
+
+// pairBound for LikelihoodScorer, the link density is the largest from the smallest
+// distance onwards
+func (r *LikelihoodScorer) pairBound(tour Tour, a, b Tig, minGap int, _ bool) float64 {
+	dist := float64(minGap) + float64(a.Size+b.Size)/2
+	nlinks := tour.M[a.Idx][b.Idx]
+	if dist > float64(tour.Limit) || nlinks == 0 {
+		return 0
+	}
+	return float64(nlinks) * (r.logProb(tour.Limit) - r.maxLogProb(int(dist)))
+}
+
+// pairBound for MLScorer, same as for LikelihoodScorer but for every link, and the
+// best orientations are taken
+func (r *MLScorer) pairBound(tour Tour, a, b Tig, minGap int, freeA bool) float64 {
+	if minGap > tour.Limit || tour.M[a.Idx][b.Idx] == 0 {
+		return 0
+	}
+	aSigns := []byte{a.Sign}
+	if freeA {
+		aSigns = []byte{'+', '-'}
+	}
+	limitLogProb := r.logProb(tour.Limit)
+	best := 0.0 // Pairs beyond the limit score zero
+	for _, ao := range aSigns {
+		for _, bo := range []byte{'+', '-'} {
+			gdists, ok := r.clm.orientedContacts[OrientedPair{a.Idx, b.Idx, ao, bo}]
+			if !ok {
+				continue
+			}
+			score := 0.0
+			for k := 0; k < BB; k++ {
+				if gdists[k] == 0 {
+					continue
+				}
+				link := min(GR[k]+minGap, tour.Limit)
+				score += float64(gdists[k]) * (limitLogProb - r.maxLogProb(link))
+			}
+			best = math.Min(best, score)
+		}
+	}
+	return best
+}
+
+// exactSearch keeps the state of the branch-and-bound
+type exactSearch struct {
+	s         pairBounder
+	tour      Tour      // Shares M, Limit and Scorer with the input tour
+	tigs      []Tig     // Input tigs
+	used      []bool    // Whether the input tig is in the prefix
+	prefix    []Tig     // Tigs placed so far
+	ends      []int     // End position of each tig in the prefix
+	free      []float64 // Bound of every pair of input tigs that are both unplaced
+	oriented  bool
+	last      int // Input tig kept for the end of the tour, -1 until picked
+	best      []Tig
+	bestScore float64
+	nodes     int
+}
+
+// bound sums up the lower bounds of all pairs that involve an unplaced tig
+func (r *exactSearch) bound() float64 {
+	n := len(r.tigs)
+	end := 0
+	if len(r.prefix) > 0 {
+		end = r.ends[len(r.prefix)-1]
+	}
+	score := 0.0
+	for j := 0; j < n; j++ {
+		if r.used[j] {
+			continue
+		}
+		for i, t := range r.prefix {
+			gap := end - r.ends[i]
+			if gap > r.tour.Limit {
+				continue
+			}
+			score += r.s.pairBound(r.tour, t, r.tigs[j], gap, false)
+		}
+		for k := j + 1; k < n; k++ {
+			if !r.used[k] {
+				score += r.free[j*n+k]
+			}
+		}
+	}
+	return score
+}
+
+// added scores the pairs between tig t and the prefix, if t were placed next
+func (r *exactSearch) added(t Tig) float64 {
+	score := 0.0
+	end := r.ends[len(r.prefix)-1]
+	for i := len(r.prefix) - 1; i >= 0; i-- {
+		gap := end - r.ends[i]
+		if gap > r.tour.Limit {
+			break
+		}
+		score += r.s.pairScore(r.tour, r.prefix[i], t, gap)
+	}
+	return score
+}
+
+// search extends the prefix in all possible ways, best candidates first
+func (r *exactSearch) search(score float64) {
+	r.nodes++
+	if r.nodes > exactMaxNodes {
+		return
+	}
+	n := len(r.tigs)
+	depth := len(r.prefix)
+	if depth == n {
+		if improves(score-r.bestScore, r.bestScore) {
+			r.best = append(r.best[:0], r.prefix...)
+			r.bestScore = score
+		}
+		return
+	}
+	if !improves(score+r.bound()-r.bestScore, r.bestScore) {
+		return
+	}
+	// Only one of a tour and its reverse is searched, the first tig has the smaller idx
+	if depth == 1 && r.last < 0 {
+		for j, t := range r.tigs {
+			if !r.used[j] && t.Idx > r.prefix[0].Idx {
+				r.last = j
+				r.search(score)
+			}
+		}
+		r.last = -1
+		return
+	}
+
+	type candidate struct {
+		j     int
+		tig   Tig
+		score float64
+	}
+	var candidates []candidate
+	for j, t := range r.tigs {
+		if r.used[j] || (j == r.last && depth < n-1) {
+			continue
+		}
+		signs := []byte{t.Sign}
+		if r.oriented {
+			signs = []byte{'+', '-'}
+		}
+		for _, sign := range signs {
+			t.Sign = sign
+			c := candidate{j, t, score}
+			if depth > 0 {
+				c.score += r.added(t)
+			}
+			candidates = append(candidates, c)
+		}
+	}
+	sort.SliceStable(candidates, func(a, b int) bool {
+		return candidates[a].score < candidates[b].score
+	})
+
+	start := 0
+	if depth > 0 {
+		start = r.ends[depth-1]
+	}
+	for _, c := range candidates {
+		r.used[c.j] = true
+		r.prefix = append(r.prefix, c.tig)
+		r.ends = append(r.ends, start+c.tig.Size)
+		r.search(c.score)
+		r.prefix = r.prefix[:depth]
+		r.ends = r.ends[:depth]
+		r.used[c.j] = false
+	}
+}
+
+// ExactRun finds the optimal ordering (and orientations if the tour is oriented) by
+// branch-and-bound, returns whether the optimum is proven
+func (r *CLM) ExactRun(fwtour *os.File) bool {
+	tour := r.Tour
+	s, ok := tour.scorer().(pairBounder)
+	if !ok || tour.Len() < 2 {
+		return false
+	}
+	n := tour.Len()
+	score, _ := tour.scorer().Score(tour)
+	search := &exactSearch{
+		s:         s,
+		tour:      tour.derive(nil),
+		tigs:      append([]Tig{}, tour.Tigs...),
+		used:      make([]bool, n),
+		free:      make([]float64, n*n),
+		oriented:  tour.oriented(),
+		last:      -1,
+		best:      append([]Tig{}, tour.Tigs...),
+		bestScore: score,
+	}
+	for j := 0; j < n; j++ {
+		for k := j + 1; k < n; k++ {
+			search.free[j*n+k] = s.pairBound(tour, search.tigs[j], search.tigs[k], 0, true)
+		}
+	}
+	log.Noticef("EXACT initialized (tigs: %d, score: %.5f, oriented: %v)", n, -score, search.oriented)
+	search.search(0)
+
+	// The label of the tour tells if the optimum is proven
+	proven := search.nodes <= exactMaxNodes
+	label := fmt.Sprintf("EXACT-%.5f", -search.bestScore)
+	if proven {
+		log.Noticef("EXACT: optimum proven after %d nodes, score: %.5f", search.nodes, -search.bestScore)
+		label = fmt.Sprintf("EXACT-proven-%.5f", -search.bestScore)
+	} else {
+		log.Warningf("EXACT: stopped after %d nodes, optimum not proven, score: %.5f",
+			exactMaxNodes, -search.bestScore)
+	}
+	r.Tour = tour.derive(search.best)
+	r.printTour(fwtour, r.Tour, label)
+	return proven
+}
@@ -0,0 +1,111 @@
+/*
+ *  exact_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/18/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"math"
+	"math/rand"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// bruteForce returns the best score over all orderings of the tour, and over all
+// orientations if oriented
+func bruteForce(tour allhic.Tour, oriented bool) float64 {
+	tigs := append([]allhic.Tig{}, tour.Tigs...)
+	tour.Tigs = tigs
+	best := math.Inf(1)
+	var permute func(k int)
+	permute = func(k int) {
+		if k == len(tigs) {
+			nSigns := 1
+			if oriented {
+				nSigns = 1 << uint(len(tigs))
+			}
+			for mask := 0; mask < nSigns; mask++ {
+				if oriented {
+					for i := range tigs {
+						tigs[i].Sign = "+-"[mask>>uint(i)&1]
+					}
+				}
+				score, _ := tour.Scorer.Score(tour)
+				best = math.Min(best, score)
+			}
+			return
+		}
+		for i := k; i < len(tigs); i++ {
+			tigs[k], tigs[i] = tigs[i], tigs[k]
+			permute(k + 1)
+			tigs[k], tigs[i] = tigs[i], tigs[k]
+		}
+	}
+	permute(0)
+	return best
+}
+
+func TestExactRun(t *testing.T) {
+	distfile := writeTestDistribution(t)
+	refile := writeSmallREfile(t, 7)
+	fwtour, err := os.Create(path.Join(t.TempDir(), "small.tour"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fwtour.Close()
+
+	for _, score := range []string{allhic.ScoreRecip, allhic.ScoreSumLog,
+		allhic.ScoreLikelihood, allhic.ScoreML} {
+		clm := allhic.NewCLM(path.Join("tests", "simulation", "test.clm"), refile)
+		scorer, err := allhic.NewScorer(score, distfile, clm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clm.Tour.Limit = allhic.LIMIT
+		clm.Tour.Scorer = scorer
+		clm.Activate(true, rand.New(rand.NewSource(42)))
+
+		expected := bruteForce(clm.Tour, score == allhic.ScoreML)
+		if !clm.ExactRun(fwtour) {
+			t.Fatalf("%s: optimum not proven", score)
+		}
+		got, _ := scorer.Score(clm.Tour)
+		if math.Abs(got-expected) > 1e-9*math.Max(1, math.Abs(expected)) {
+			t.Fatalf("%s: expected optimal score %.6f, got %.6f", score, expected, got)
+		}
+	}
+}
+
+func TestExactProvenLabel(t *testing.T) {
+	p := allhic.Optimizer{REfile: writeSmallREfile(t, 7),
+		Clmfile: path.Join("tests", "simulation", "test.clm"),
+		RunGA:   true, Seed: 42, NPop: 20, NGen: 50, MutProb: .2, ExactSize: 7}
+	p.Run()
+	tf, err := allhic.ReadTourFile(p.OutTourFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The proof stays with its tour when the tour file is written again
+	copyfile := path.Join(t.TempDir(), "copy.tour")
+	if err := tf.WriteFile(copyfile); err != nil {
+		t.Fatal(err)
+	}
+	if tf, err = allhic.ReadTourFile(copyfile); err != nil {
+		t.Fatal(err)
+	}
+	var labels []string
+	for _, record := range tf.Records {
+		labels = append(labels, record.Label)
+	}
+	if len(labels) < 2 || labels[0] != "INIT" || !strings.HasPrefix(labels[1], "EXACT-proven-") {
+		t.Fatalf("Expected INIT followed by the proven EXACT tour, got %v", labels)
+	}
+}
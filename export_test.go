@@ -0,0 +1,50 @@
+/*
+ *  export_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/18/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import "math/rand"
+
+// Internals used by the tests in allhic_test
+
+// ReadDistribution calls readDistribution
+var ReadDistribution = readDistribution
+
+// WriteDistribution calls writeDistribution
+func (r *LinkDensityModel) WriteDistribution(outfile string) {
+	r.writeDistribution(outfile)
+}
+
+// CheckUnplacedNames calls checkUnplacedNames
+var CheckUnplacedNames = checkUnplacedNames
+
+// PruneBySize calls pruneBySize
+func (r *CLM) PruneBySize(minSize int) error {
+	return r.pruneBySize(minSize)
+}
+
+// MoveBlock calls moveBlock
+func (r Tour) MoveBlock(i, k, j int, reverse bool) (float64, func()) {
+	return r.moveBlock(i, k, j, reverse)
+}
+
+// RandomMove calls randomMove
+func (r Tour) RandomMove(rng *rand.Rand) (float64, func()) {
+	return r.randomMove(rng)
+}
+
+// TwoOpt and OrOpt are the moves of LocalSearchRun
+var (
+	TwoOpt = Tour.twoOpt
+	OrOpt  = Tour.orOpt
+)
+
+// SeedRNG sets up the random number generator of the Optimizer from its seed
+func (r *Optimizer) SeedRNG() {
+	r.rng = rand.New(rand.NewSource(r.Seed))
+}
@@ -356,53 +356,7 @@ func (r *Extracter) findExpectedIntraContigLinks(L int) []float64 {
 
 // findExpectedInterContigLinks calculates the expected number of links between two contigs
 func (r *Extracter) findExpectedInterContigLinks(D, L1, L2 int) []float64 {
-	if L1 > L2 {
-		L1, L2 = L2, L1
-	}
-	nExpectedLinks := make([]float64, nBins)
-	m := r.model
-
-	for i := 0; i < nBins; i++ {
-		binStart := m.binStarts[i]
-		binStop := m.binStarts[i+1]
-
-		if binStop <= D {
-			continue
-		}
-		if binStart >= D+L1+L2 {
-			break
-		}
-
-		nObservableLinks := 0
-
-		// If the bin falls along the left slope of the trapezoid
-		if binStart < D+L1 {
-			left := max(binStart, D)
-			right := min(binStop, D+L1)
-			middleX := (left + right) / 2
-			middleY := middleX - D
-			nObservableLinks += (right - left) * middleY
-		}
-
-		// If the bin falls along the flat middle of the trapezoid
-		if binStop >= D+L1 && binStart < D+L2 {
-			left := max(binStart, D+L1)
-			right := min(binStop, D+L2)
-			nObservableLinks += (right - left) * L1
-		}
-
-		// If the bin falls along the right slope of the trapezoid
-		if binStop >= D+L2 {
-			left := max(binStart, D+L2)
-			right := min(binStop, D+L1+L2)
-			middleX := (left + right) / 2
-			middleY := D + L1 + L2 - middleX
-			nObservableLinks += (right - left) * middleY
-		}
-		nExpectedLinks[i] = float64(nObservableLinks) * m.linkDensity[i]
-	}
-
-	return nExpectedLinks
+	return r.model.expectedInterContigLinks(D, L1, L2)
 }
 
 // extractContigLinks converts the BAM file to .clm and .ids
@@ -0,0 +1,462 @@
+/*
+ *  fasta.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/18/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+)
+
+// The contigs for build are fetched one component at a time. With a .fai index (and
+// a .gzi index for a bgzipped FASTA), only the bytes of the component are read, so
+// the memory is bounded by the largest component. Without an index, an uncompressed
+// FASTA is indexed with one pass over the file, and other inputs are loaded in memory.
+
+// contigSource gives the contig sizes and fetches the contig sequences
+type contigSource interface {
+	// names returns the contig names in the order of the FASTA file
+	names() []string
+	// size returns the size of the contig, false if the contig is not found
+	size(name string) (int, bool)
+	// fetch returns the bases from beg to end, 1-based and inclusive
+	fetch(name string, beg, end int) ([]byte, error)
+	Close() error
+}
+
+// openContigSource picks the contig source based on the indices next to the fastafile
+func openContigSource(fastafile string) (contigSource, error) {
+	compressed, err := isGzip(fastafile)
+	if err != nil {
+		return nil, err
+	}
+	faifile, gzifile := fastafile+".fai", fastafile+".gzi"
+	if _, err := os.Stat(faifile); err == nil {
+		records, err := readFai(faifile)
+		if err != nil {
+			return nil, err
+		}
+		if !compressed {
+			log.Noticef("Fetch contigs from `%s` with `%s`", fastafile, faifile)
+			return newIndexedFasta(fastafile, records, nil)
+		}
+		if _, err := os.Stat(gzifile); err == nil {
+			offsets, err := readGzi(gzifile)
+			if err != nil {
+				return nil, err
+			}
+			log.Noticef("Fetch contigs from `%s` with `%s` and `%s`", fastafile, faifile, gzifile)
+			return newIndexedFasta(fastafile, records, offsets)
+		}
+		log.Warningf("`%s` is compressed without `%s`, loading all contigs in memory",
+			fastafile, gzifile)
+	} else if !compressed {
+		records, err := scanFai(fastafile)
+		if err == nil {
+			log.Noticef("Fetch contigs from `%s` indexed in one pass", fastafile)
+			return newIndexedFasta(fastafile, records, nil)
+		}
+		log.Warningf("Cannot index `%s` (%v), loading all contigs in memory", fastafile, err)
+	}
+	return newMemoryFasta(fastafile)
+}
+
+// contigSizes returns the size of every contig
+func contigSizes(src contigSource) map[string]int {
+	sizes := make(map[string]int)
+	for _, name := range src.names() {
+		sizes[name], _ = src.size(name)
+	}
+	return sizes
+}
+
+// isGzip checks the magic number of gzip, which is also that of bgzip
+func isGzip(filename string) (bool, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	magic := make([]byte, 2)
+	n, _ := io.ReadFull(f, magic)
+	return n == 2 && magic[0] == 0x1f && magic[1] == 0x8b, nil
+}
+
+// memoryFasta keeps all the contigs in memory
+type memoryFasta struct {
+	order []string
+	seqs  map[string]*seq.Seq
+}
+
+// newMemoryFasta reads all the contigs in the fastafile
+func newMemoryFasta(fastafile string) (*memoryFasta, error) {
+	log.Noticef("Parse FASTA file `%s`", fastafile)
+	reader, err := fastx.NewDefaultReader(fastafile)
+	if err != nil {
+		return nil, err
+	}
+	seq.ValidateSeq = false
+	r := &memoryFasta{seqs: map[string]*seq.Seq{}}
+	for {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := string(rec.ID)
+		r.seqs[name] = rec.Seq.Clone()
+		r.order = append(r.order, name)
+	}
+	return r, nil
+}
+
+func (r *memoryFasta) names() []string {
+	return r.order
+}
+
+func (r *memoryFasta) size(name string) (int, bool) {
+	s, ok := r.seqs[name]
+	if !ok {
+		return 0, false
+	}
+	return s.Length(), true
+}
+
+func (r *memoryFasta) fetch(name string, beg, end int) ([]byte, error) {
+	s, ok := r.seqs[name]
+	if !ok {
+		return nil, fmt.Errorf("cannot locate %s", name)
+	}
+	if beg < 1 || end > s.Length() || beg > end {
+		return nil, fmt.Errorf("range %d-%d is outside of %s", beg, end, name)
+	}
+	// A copy, as the caller may reverse complement it
+	return append([]byte(nil), s.Seq[beg-1:end]...), nil
+}
+
+func (r *memoryFasta) Close() error {
+	return nil
+}
+
+// faiRecord is a line in the .fai index of samtools faidx
+type faiRecord struct {
+	name      string
+	length    int
+	offset    int64 // Offset of the first base in the uncompressed FASTA
+	lineBases int
+	lineWidth int // Bases per line plus the line break
+}
+
+// readFai parses the .fai index
+func readFai(faifile string) ([]faiRecord, error) {
+	f, err := os.Open(faifile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var records []faiRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		words := strings.Split(strings.TrimRight(scanner.Text(), "\r"), "\t")
+		if len(words) < 5 {
+			return nil, fmt.Errorf("invalid fai record: %s", scanner.Text())
+		}
+		var rec faiRecord
+		var errs [4]error
+		rec.name = words[0]
+		rec.length, errs[0] = strconv.Atoi(words[1])
+		rec.offset, errs[1] = strconv.ParseInt(words[2], 10, 64)
+		rec.lineBases, errs[2] = strconv.Atoi(words[3])
+		rec.lineWidth, errs[3] = strconv.Atoi(words[4])
+		for _, err := range errs {
+			if err != nil {
+				return nil, fmt.Errorf("invalid fai record: %s", scanner.Text())
+			}
+		}
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
+
+// scanFai builds the .fai index of an uncompressed FASTA in one pass, which requires
+// all the lines of a sequence to have the same length except the last one
+func scanFai(fastafile string) ([]faiRecord, error) {
+	f, err := os.Open(fastafile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	reader := bufio.NewReader(f)
+	// readLine measures the next line without keeping it, so lines can be of any length
+	readLine := func() (head []byte, width, bases int, err error) {
+		for {
+			var chunk []byte
+			chunk, err = reader.ReadSlice('\n')
+			if width == 0 && len(chunk) > 0 && chunk[0] == '>' {
+				head = append([]byte(nil), chunk...)
+			}
+			width += len(chunk)
+			bases += len(bytes.TrimRight(chunk, "\r\n"))
+			if err != bufio.ErrBufferFull {
+				return
+			}
+		}
+	}
+
+	var records []faiRecord
+	var rec *faiRecord
+	offset := int64(0)
+	lastLine := false // Whether the last line of the sequence is seen
+	for {
+		head, width, bases, err := readLine()
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if width == 0 {
+			break
+		}
+		switch {
+		case head != nil:
+			fields := strings.Fields(string(head[1:]))
+			if len(fields) == 0 {
+				return nil, fmt.Errorf("sequence without a name at byte %d", offset)
+			}
+			records = append(records, faiRecord{name: fields[0], offset: offset + int64(width)})
+			rec = &records[len(records)-1]
+			lastLine = false
+		case rec == nil:
+			if bases > 0 {
+				return nil, fmt.Errorf("sequence before the first header")
+			}
+		case bases == 0:
+			lastLine = lastLine || rec.length > 0
+		case lastLine:
+			return nil, fmt.Errorf("lines of different lengths in %s", rec.name)
+		case rec.lineBases == 0:
+			rec.lineBases, rec.lineWidth = bases, width
+			rec.length += bases
+		case bases > rec.lineBases || (err == nil && width-bases != rec.lineWidth-rec.lineBases):
+			return nil, fmt.Errorf("lines of different lengths in %s", rec.name)
+		default:
+			lastLine = bases < rec.lineBases
+			rec.length += bases
+		}
+		offset += int64(width)
+		if err == io.EOF {
+			break
+		}
+	}
+	return records, nil
+}
+
+// readGzi parses the .gzi index of bgzip, pairs of the compressed and the
+// uncompressed offsets of the blocks
+func readGzi(gzifile string) ([][2]int64, error) {
+	f, err := os.Open(gzifile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var n uint64
+	if err := binary.Read(f, binary.LittleEndian, &n); err != nil {
+		return nil, err
+	}
+	entries := make([]uint64, 2*n)
+	if err := binary.Read(f, binary.LittleEndian, entries); err != nil {
+		return nil, err
+	}
+	offsets := [][2]int64{{0, 0}} // The first block is implicit
+	for i := uint64(0); i < n; i++ {
+		offsets = append(offsets, [2]int64{int64(entries[2*i]), int64(entries[2*i+1])})
+	}
+	return offsets, nil
+}
+
+// bgzfReader reads the uncompressed bytes at any offset of a bgzipped file
+type bgzfReader struct {
+	f       *os.File
+	offsets [][2]int64
+	gz      *gzip.Reader
+}
+
+// ReadAt decompresses from the last block that starts at or before off
+func (r *bgzfReader) ReadAt(p []byte, off int64) (int, error) {
+	i := sort.Search(len(r.offsets), func(i int) bool { return r.offsets[i][1] > off }) - 1
+	if _, err := r.f.Seek(r.offsets[i][0], io.SeekStart); err != nil {
+		return 0, err
+	}
+	br := bufio.NewReader(r.f)
+	var err error
+	if r.gz == nil {
+		r.gz, err = gzip.NewReader(br)
+	} else {
+		err = r.gz.Reset(br)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if _, err := io.CopyN(ioutil.Discard, r.gz, off-r.offsets[i][1]); err != nil {
+		return 0, err
+	}
+	return io.ReadFull(r.gz, p)
+}
+
+// indexedFasta fetches the contigs with the .fai index
+type indexedFasta struct {
+	f       *os.File
+	reader  io.ReaderAt
+	records []faiRecord
+	idx     map[string]int
+}
+
+// newIndexedFasta opens the fastafile, which is bgzipped if offsets from .gzi are given
+func newIndexedFasta(fastafile string, records []faiRecord, offsets [][2]int64) (*indexedFasta, error) {
+	f, err := os.Open(fastafile)
+	if err != nil {
+		return nil, err
+	}
+	r := &indexedFasta{f: f, reader: f, records: records, idx: make(map[string]int)}
+	if offsets != nil {
+		r.reader = &bgzfReader{f: f, offsets: offsets}
+	}
+	for i, rec := range records {
+		r.idx[rec.name] = i
+	}
+	return r, nil
+}
+
+func (r *indexedFasta) names() []string {
+	names := make([]string, len(r.records))
+	for i, rec := range r.records {
+		names[i] = rec.name
+	}
+	return names
+}
+
+func (r *indexedFasta) size(name string) (int, bool) {
+	i, ok := r.idx[name]
+	if !ok {
+		return 0, false
+	}
+	return r.records[i].length, true
+}
+
+func (r *indexedFasta) fetch(name string, beg, end int) ([]byte, error) {
+	i, ok := r.idx[name]
+	if !ok {
+		return nil, fmt.Errorf("cannot locate %s", name)
+	}
+	rec := r.records[i]
+	if beg < 1 || end > rec.length || beg > end {
+		return nil, fmt.Errorf("range %d-%d is outside of %s", beg, end, name)
+	}
+	position := func(i int) int64 { // Offset of the base i, 0-based
+		return rec.offset + int64(i/rec.lineBases*rec.lineWidth+i%rec.lineBases)
+	}
+	start, stop := position(beg-1), position(end-1)+1
+	buf := make([]byte, stop-start)
+	if _, err := r.reader.ReadAt(buf, start); err != nil {
+		return nil, fmt.Errorf("cannot read %s: %v", name, err)
+	}
+	// Remove the line breaks in place
+	bases := buf[:0]
+	for _, b := range buf {
+		if b != '\n' && b != '\r' {
+			bases = append(bases, b)
+		}
+	}
+	if len(bases) != end-beg+1 {
+		return nil, fmt.Errorf("%s does not match the index", name)
+	}
+	return bases, nil
+}
+
+func (r *indexedFasta) Close() error {
+	return r.f.Close()
+}
+
+// complement of the IUPAC bases, others are kept
+var complement = func() [256]byte {
+	var c [256]byte
+	for i := range c {
+		c[i] = byte(i)
+	}
+	pairs := []string{"AT", "CG", "RY", "KM", "BV", "DH", "NN", "SS", "WW"}
+	for _, pair := range pairs {
+		for _, p := range []string{pair, strings.ToLower(pair)} {
+			c[p[0]], c[p[1]] = p[1], p[0]
+		}
+	}
+	return c
+}()
+
+// reverseComplement reverse complements the bases in place
+func reverseComplement(s []byte) {
+	for i, j := 0, len(s)-1; i <= j; i, j = i+1, j-1 {
+		s[i], s[j] = complement[s[j]], complement[s[i]]
+	}
+}
+
+// fastaWriter writes the sequences in chunks, wrapping the lines at LineWidth
+type fastaWriter struct {
+	w      *xopen.Writer
+	name   string
+	size   int
+	column int
+}
+
+// start writes the header of a new sequence
+func (r *fastaWriter) start(name string) {
+	r.finish()
+	r.name, r.size, r.column = name, 0, 0
+	_, _ = fmt.Fprintf(r.w, ">%s\n", name)
+}
+
+// write adds the bases to the current sequence
+func (r *fastaWriter) write(bases []byte) {
+	for len(bases) > 0 {
+		n := min(LineWidth-r.column, len(bases))
+		_, _ = r.w.Write(bases[:n])
+		bases = bases[n:]
+		r.column += n
+		r.size += n
+		if r.column == LineWidth {
+			_ = r.w.WriteByte('\n')
+			r.column = 0
+		}
+	}
+}
+
+// finish ends the current sequence
+func (r *fastaWriter) finish() {
+	if r.name == "" {
+		return
+	}
+	if r.column > 0 {
+		_ = r.w.WriteByte('\n')
+	}
+	if r.size > LargeSequence {
+		log.Noticef("Write sequence %s (size = %d bp)", r.name, r.size)
+	}
+	r.name = ""
+}
@@ -0,0 +1,130 @@
+/*
+ *  gap.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/18/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"math"
+)
+
+// Gap sizes between adjacent contigs in a tour. The .clm lists, for each oriented pair
+// of contigs, the link distances as if the two contigs were adjacent, so a gap of D
+// adds D to every link. Conditioned on the links being between the two contigs, each
+// link has the probability density(d + D) / E(D), where E(D) sums the density over
+// all pairs of positions across the gap, see LinkDensityModel.expectedInterContigLinks. We take the D that maximizes the likelihood
+// of all the links.
+
+const (
+	// gapMinLinks is the smallest number of links to trust the estimate
+	gapMinLinks = 10
+	// gapMaxSize is the largest gap size considered
+	gapMaxSize = 1000000
+	// gapGridRatio is the ratio between consecutive gap sizes in the search
+	gapGridRatio = 1.02
+	// gapSupport is the drop in log likelihood that bounds the support interval
+	gapSupport = 2.0
+	// gapEvidence is the linkage evidence of the estimated gaps in the AGP
+	gapEvidence = "proximity_ligation"
+)
+
+// gapEstimator fits the gap sizes given the link size distribution
+type gapEstimator struct {
+	scorer *LikelihoodScorer      // Source of the log link density
+	links  map[OrientedPair][]int // Link distances of the oriented pairs in the .clm
+	idx    map[string]int         // From the name of the contig to the idx in links
+}
+
+// newGapEstimator reads the link distances in the clmfile and the distribution
+func newGapEstimator(clmfile, distfile string) (*gapEstimator, error) {
+	model, err := readDistribution(distfile)
+	if err != nil {
+		return nil, err
+	}
+	r := &gapEstimator{
+		scorer: NewLikelihoodScorer(model),
+		links:  make(map[OrientedPair][]int),
+		idx:    make(map[string]int),
+	}
+	index := func(name string) int {
+		if _, ok := r.idx[name]; !ok {
+			r.idx[name] = len(r.idx)
+		}
+		return r.idx[name]
+	}
+	for _, line := range readClmLines(clmfile) {
+		ai, bi := index(line.at), index(line.bt)
+		r.links[OrientedPair{ai, bi, line.ao, line.bo}] = line.links
+		r.links[OrientedPair{bi, ai, rr(line.bo), rr(line.ao)}] = line.links
+	}
+	return r, nil
+}
+
+// logExpected is the log of E(D), the number of links expected across a gap of D in
+// the link size distribution, as for the contig pairs in extract
+func (r *gapEstimator) logExpected(D, L1, L2 int) float64 {
+	return math.Log(sumf(r.scorer.model.expectedInterContigLinks(D, L1, L2)))
+}
+
+// logLikelihood of the links given a gap of D
+func (r *gapEstimator) logLikelihood(links []int, D, L1, L2 int) float64 {
+	score := 0.0
+	for _, link := range links {
+		score += r.scorer.logProb(link + D)
+	}
+	return score - float64(len(links))*r.logExpected(D, L1, L2)
+}
+
+// estimate fits the gap between contig a and contig b to its right, returns false if
+// the fit is unreliable, i.e. with too few links, or with a support interval that is
+// not bounded within gapMaxSize
+func (r *gapEstimator) estimate(a, b OOLine) (int, bool) {
+	ai, aok := r.idx[a.componentID]
+	bi, bok := r.idx[b.componentID]
+	if !aok || !bok || a.strand == '?' || b.strand == '?' {
+		return 0, false
+	}
+	links := r.links[OrientedPair{ai, bi, a.strand, b.strand}]
+	if len(links) < gapMinLinks {
+		return 0, false
+	}
+
+	var gaps []int
+	var scores []float64
+	for D := 0.0; D <= gapMaxSize; D = math.Max(D*gapGridRatio, D+1) {
+		gaps = append(gaps, int(D))
+		scores = append(scores, r.logLikelihood(links, int(D), a.componentSize, b.componentSize))
+	}
+	best := 0
+	for i := range scores {
+		if scores[i] > scores[best] {
+			best = i
+		}
+	}
+	if scores[len(scores)-1] > scores[best]-gapSupport {
+		return 0, false
+	}
+	return gaps[best], true
+}
+
+// estimateGaps fits the gaps between the adjacent contigs in the same scaffold
+func (r *OO) estimateGaps(est *gapEstimator) {
+	nEstimated, nGaps := 0, 0
+	for i := 1; i < len(r.entries); i++ {
+		prev, cur := r.entries[i-1], &r.entries[i]
+		if prev.id != cur.id {
+			continue
+		}
+		nGaps++
+		if gap, ok := est.estimate(prev, *cur); ok {
+			cur.gapSize = max(gap, 1)
+			nEstimated++
+		}
+	}
+	log.Noticef("Gap sizes estimated for %d of %d gaps, the rest are %d-bp U gaps",
+		nEstimated, nGaps, DefaultGapSize)
+}
@@ -0,0 +1,134 @@
+/*
+ *  graph.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/18/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Besides the AGP, the scaffolds can be written as a UCSC chain file from the contigs
+// to the objects, for liftOver and the genome browsers, and as a GFA 1.0 graph of the
+// oriented contigs, for the graph viewers like Bandage.
+
+// GFAGapTag is the tag of the gap size on the links in the GFA, left off when the gap
+// has a U gap of unknown size
+const GFAGapTag = "gl:i"
+
+// componentName is the name of the component, with the range if it is part of a contig
+func componentName(line AGPLine, sizes map[string]int) string {
+	if line.componentBeg == 1 && line.componentEnd == sizes[line.componentID] {
+		return line.componentID
+	}
+	return fmt.Sprintf("%s:%d-%d", line.componentID, line.componentBeg, line.componentEnd)
+}
+
+// objectSizes returns the size of each object
+func (r *AGP) objectSizes() map[string]int {
+	sizes := make(map[string]int)
+	for _, line := range r.lines {
+		sizes[line.object] = max(sizes[line.object], line.objectEnd)
+	}
+	return sizes
+}
+
+// writeChain writes one chain for each component, from the contig to the object. As
+// in the chain format, the coordinates are 0-based and on the reverse complement of
+// the object for a '-' component.
+// https://genome.ucsc.edu/goldenPath/help/chain.html
+func writeChain(agp *AGP, sizes map[string]int, chainfile string) error {
+	f, err := os.Create(chainfile)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	objectSizes := agp.objectSizes()
+	id := 0
+	for _, line := range agp.lines {
+		if line.isGap {
+			continue
+		}
+		id++
+		size := line.componentEnd - line.componentBeg + 1
+		qSize := objectSizes[line.object]
+		qStrand, qStart, qEnd := '+', line.objectBeg-1, line.objectEnd
+		if line.orientation == "-" {
+			qStrand, qStart, qEnd = '-', qSize-line.objectEnd, qSize-line.objectBeg+1
+		}
+		fmt.Fprintf(w, "chain %d %s %d + %d %d %s %d %c %d %d %d\n%d\n\n",
+			size, line.componentID, sizes[line.componentID], line.componentBeg-1, line.componentEnd,
+			line.object, qSize, qStrand, qStart, qEnd, id, size)
+	}
+	if err := w.Flush(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeGFA writes the components as segments, the adjacent components in an object as
+// links with the gap sizes, and each object as a path. The sequences are not included.
+// https://gfa-spec.github.io/GFA-spec/GFA1.html
+func writeGFA(agp *AGP, sizes map[string]int, gfafile string) error {
+	f, err := os.Create(gfafile)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprintln(w, "H\tVN:Z:1.0")
+	sign := func(line AGPLine) string {
+		if line.orientation == "-" {
+			return "-"
+		}
+		return "+"
+	}
+	for _, line := range agp.lines {
+		if !line.isGap {
+			fmt.Fprintf(w, "S\t%s\t*\tLN:i:%d\n", componentName(line, sizes),
+				line.componentEnd-line.componentBeg+1)
+		}
+	}
+	var path []string
+	flush := func(object string) {
+		if len(path) > 0 {
+			fmt.Fprintf(w, "P\t%s\t%s\t*\n", object, strings.Join(path, ","))
+		}
+		path = path[:0]
+	}
+	var prev AGPLine
+	gapSize, unknown := 0, false
+	for _, line := range agp.lines {
+		if line.isGap {
+			gapSize += line.gapLength
+			unknown = unknown || line.componentType == 'U'
+			continue
+		}
+		if len(path) > 0 && line.object != prev.object {
+			flush(prev.object)
+		}
+		if len(path) > 0 {
+			fmt.Fprintf(w, "L\t%s\t%s\t%s\t%s\t0M", componentName(prev, sizes), sign(prev),
+				componentName(line, sizes), sign(line))
+			if !unknown {
+				fmt.Fprintf(w, "\t%s:%d", GFAGapTag, gapSize)
+			}
+			fmt.Fprintln(w)
+		}
+		path = append(path, componentName(line, sizes)+sign(line))
+		prev, gapSize, unknown = line, 0, false
+	}
+	flush(prev.object)
+	if err := w.Flush(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
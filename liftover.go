@@ -0,0 +1,488 @@
+/*
+ *  liftover.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/18/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+)
+
+// Liftover transforms the coordinates between the contigs (components) and the
+// objects in an AGP. Features on a '-' component are flipped to the other strand.
+// Features that cannot be lifted as a whole, e.g. those that span a gap, are
+// written to the .unmapped file with the reason, like the UCSC liftOver.
+
+const (
+	// FormatBED is BED, 0-based and half-open
+	FormatBED = "bed"
+	// FormatGFF is GFF3, 1-based and inclusive
+	FormatGFF = "gff3"
+	// FormatVCF is VCF, 1-based
+	FormatVCF = "vcf"
+)
+
+var (
+	errLiftNotFound = errors.New("not in the AGP")
+	errLiftGap      = errors.New("spans a gap")
+	errLiftSplit    = errors.New("spans more than one component")
+	errLiftIndel    = errors.New("indel on a '-' component cannot be anchored without the reference")
+	errLiftEnd      = errors.New("record with END on a '-' component cannot be anchored without the reference")
+)
+
+// Lifter converts BED, GFF3 or VCF files with the AGP
+type Lifter struct {
+	AGPfile string
+	Infile  string
+	Format  string // One of bed, gff3 and vcf, guessed from the extension if empty
+	Reverse bool   // From the objects back to the contigs
+	// Output file
+	Outfile         string
+	OutUnmappedfile string
+
+	lm *liftMap
+}
+
+// liftMap finds the AGP line at any position of a source sequence, the contigs, or
+// the objects if reverse
+type liftMap struct {
+	pieces  map[string][]AGPLine // Lines of each source sequence, sorted by the start
+	reverse bool
+}
+
+// newLiftMap indexes the AGP lines by the source sequences
+func newLiftMap(agp *AGP, reverse bool) *liftMap {
+	r := &liftMap{pieces: make(map[string][]AGPLine), reverse: reverse}
+	for _, line := range agp.lines {
+		if !reverse && line.isGap {
+			continue
+		}
+		seqid := r.source(line)
+		r.pieces[seqid] = append(r.pieces[seqid], line)
+	}
+	for _, pieces := range r.pieces {
+		sort.Slice(pieces, func(i, j int) bool {
+			return r.sourceRange(pieces[i])[0] < r.sourceRange(pieces[j])[0]
+		})
+	}
+	return r
+}
+
+// source is the name of the source sequence of the line
+func (r *liftMap) source(line AGPLine) string {
+	if r.reverse {
+		return line.object
+	}
+	return line.componentID
+}
+
+// sourceRange is the range of the line on the source sequence
+func (r *liftMap) sourceRange(line AGPLine) [2]int {
+	if r.reverse {
+		return [2]int{line.objectBeg, line.objectEnd}
+	}
+	return [2]int{line.componentBeg, line.componentEnd}
+}
+
+// targets lists the target sequences with their sizes, the contig sizes are the
+// largest ends in the AGP as the AGP has no contig sizes
+func (r *liftMap) targets() ([]string, map[string]int) {
+	var names []string
+	sizes := make(map[string]int)
+	for _, pieces := range r.pieces {
+		for _, line := range pieces {
+			if line.isGap {
+				continue
+			}
+			target, end := line.object, line.objectEnd
+			if r.reverse {
+				target, end = line.componentID, line.componentEnd
+			}
+			if _, ok := sizes[target]; !ok {
+				names = append(names, target)
+			}
+			sizes[target] = max(sizes[target], end)
+		}
+	}
+	sort.Strings(names)
+	return names, sizes
+}
+
+// liftPosition converts the position on the source to the target of the line
+func (r *liftMap) liftPosition(line AGPLine, x int) int {
+	srcBeg, dstBeg, dstEnd := line.componentBeg, line.objectBeg, line.objectEnd
+	if r.reverse {
+		srcBeg, dstBeg, dstEnd = line.objectBeg, line.componentBeg, line.componentEnd
+	}
+	if line.orientation == "-" {
+		return dstEnd - (x - srcBeg)
+	}
+	return dstBeg + (x - srcBeg)
+}
+
+// lift converts the range from start to end, 1-based and inclusive, and returns the
+// target sequence, the range and whether the strand is flipped
+func (r *liftMap) lift(seqid string, start, end int) (string, int, int, bool, error) {
+	pieces := r.pieces[seqid]
+	i := sort.Search(len(pieces), func(i int) bool {
+		return r.sourceRange(pieces[i])[1] >= start
+	})
+	if i == len(pieces) || r.sourceRange(pieces[i])[0] > start {
+		return "", 0, 0, false, errLiftNotFound
+	}
+	line := pieces[i]
+	if end > r.sourceRange(line)[1] {
+		for _, next := range pieces[i:] {
+			if r.sourceRange(next)[0] > end {
+				break
+			}
+			if next.isGap {
+				return "", 0, 0, false, errLiftGap
+			}
+		}
+		return "", 0, 0, false, errLiftSplit
+	}
+	if line.isGap {
+		return "", 0, 0, false, errLiftGap
+	}
+	target := line.object
+	if r.reverse {
+		target = line.componentID
+	}
+	a, b := r.liftPosition(line, start), r.liftPosition(line, end)
+	if line.orientation == "-" {
+		return target, b, a, true, nil
+	}
+	return target, a, b, false, nil
+}
+
+// guessFormat returns the format from the extension, after removing .gz
+func guessFormat(filename string) string {
+	ext := strings.ToLower(path.Ext(strings.TrimSuffix(filename, ".gz")))
+	switch ext {
+	case ".bed":
+		return FormatBED
+	case ".gff", ".gff3":
+		return FormatGFF
+	case ".vcf":
+		return FormatVCF
+	}
+	return ""
+}
+
+// flipStrand changes + to - and vice versa, others are kept
+func flipStrand(strand string) string {
+	switch strand {
+	case "+":
+		return "-"
+	case "-":
+		return "+"
+	}
+	return strand
+}
+
+// liftInsertion lifts the insertion point before the base at pos, 1-based, with the
+// base to its right, or the base to its left at the end of the sequence. Returns the
+// target sequence, the insertion point as the number of bases before it, and whether
+// the strand is flipped.
+func (r *liftMap) liftInsertion(seqid string, pos int) (string, int, bool, error) {
+	target, beg, _, flipped, err := r.lift(seqid, pos, pos)
+	if err == nil {
+		if flipped {
+			return target, beg, true, nil
+		}
+		return target, beg - 1, false, nil
+	}
+	if pos <= 1 {
+		return "", 0, false, err
+	}
+	target, beg, _, flipped, errLeft := r.lift(seqid, pos-1, pos-1)
+	if errLeft != nil {
+		return "", 0, false, err
+	}
+	if flipped {
+		return target, beg - 1, true, nil
+	}
+	return target, beg, false, nil
+}
+
+// liftBED lifts a BED record, including the thick range and the blocks. A record of
+// zero length is an insertion point, and stays one.
+func (r *Lifter) liftBED(fields []string) error {
+	if len(fields) < 3 {
+		return fmt.Errorf("expected at least 3 columns, got %d", len(fields))
+	}
+	seqid := fields[0]
+	start, err1 := strconv.Atoi(fields[1])
+	end, err2 := strconv.Atoi(fields[2])
+	if err1 != nil || err2 != nil || end < start {
+		return fmt.Errorf("invalid range %s-%s", fields[1], fields[2])
+	}
+	var (
+		target    string
+		beg, stop int // 1-based and inclusive, stop is beg - 1 for an insertion point
+		flipped   bool
+		err       error
+	)
+	if end == start {
+		var point int
+		target, point, flipped, err = r.lm.liftInsertion(seqid, start+1)
+		beg, stop = point+1, point
+	} else {
+		target, beg, stop, flipped, err = r.lm.lift(seqid, start+1, end)
+	}
+	if err != nil {
+		return err
+	}
+	if len(fields) >= 8 {
+		thickStart, err1 := strconv.Atoi(fields[6])
+		thickEnd, err2 := strconv.Atoi(fields[7])
+		if err1 != nil || err2 != nil {
+			return fmt.Errorf("invalid thick range %s-%s", fields[6], fields[7])
+		}
+		if thickEnd > thickStart {
+			_, thickBeg, thickStop, _, err := r.lm.lift(seqid, thickStart+1, thickEnd)
+			if err != nil {
+				return err
+			}
+			fields[6], fields[7] = strconv.Itoa(thickBeg-1), strconv.Itoa(thickStop)
+		} else { // No thick part
+			fields[6], fields[7] = strconv.Itoa(beg-1), strconv.Itoa(beg-1)
+		}
+	}
+	if len(fields) >= 12 && flipped {
+		fields[10], fields[11] = flipBlocks(fields[10], fields[11], end-start)
+	}
+	if len(fields) >= 6 && flipped {
+		fields[5] = flipStrand(fields[5])
+	}
+	fields[0], fields[1], fields[2] = target, strconv.Itoa(beg-1), strconv.Itoa(stop)
+	return nil
+}
+
+// flipBlocks reverses the blocks of a BED record of the given size, the block starts
+// are relative to the start of the record
+func flipBlocks(blockSizes, blockStarts string, size int) (string, string) {
+	sizes := strings.Split(strings.TrimSuffix(blockSizes, ","), ",")
+	starts := strings.Split(strings.TrimSuffix(blockStarts, ","), ",")
+	if len(sizes) != len(starts) {
+		return blockSizes, blockStarts
+	}
+	n := len(sizes)
+	newSizes, newStarts := make([]string, n), make([]string, n)
+	for i := range sizes {
+		blockSize, _ := strconv.Atoi(sizes[i])
+		blockStart, _ := strconv.Atoi(starts[i])
+		newSizes[n-1-i] = sizes[i]
+		newStarts[n-1-i] = strconv.Itoa(size - blockStart - blockSize)
+	}
+	return strings.Join(newSizes, ","), strings.Join(newStarts, ",")
+}
+
+// liftGFF lifts a GFF3 feature
+func (r *Lifter) liftGFF(fields []string) error {
+	if len(fields) != 9 {
+		return fmt.Errorf("expected 9 columns, got %d", len(fields))
+	}
+	start, err1 := strconv.Atoi(fields[3])
+	end, err2 := strconv.Atoi(fields[4])
+	if err1 != nil || err2 != nil || end < start {
+		return fmt.Errorf("invalid range %s-%s", fields[3], fields[4])
+	}
+	target, beg, stop, flipped, err := r.lm.lift(fields[0], start, end)
+	if err != nil {
+		return err
+	}
+	fields[0], fields[3], fields[4] = target, strconv.Itoa(beg), strconv.Itoa(stop)
+	if flipped {
+		fields[6] = flipStrand(fields[6])
+	}
+	return nil
+}
+
+// liftVCF lifts a VCF record, the alleles on a '-' component are reverse complemented.
+// Indels are anchored on the base before them, which is unknown for a '-' component
+// without the reference, so these are not lifted. Neither are the records with an
+// INFO/END, e.g. SVs and gVCF blocks, on a '-' component for the same reason, the END
+// of the others is lifted with the POS.
+func (r *Lifter) liftVCF(fields []string) error {
+	if len(fields) < 5 {
+		return fmt.Errorf("expected at least 5 columns, got %d", len(fields))
+	}
+	pos, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return fmt.Errorf("invalid position %s", fields[1])
+	}
+	ref, alts := fields[3], strings.Split(fields[4], ",")
+	end := pos + len(ref) - 1
+	var info []string
+	endItem := -1 // Index of END in the INFO
+	if len(fields) >= 8 && fields[7] != "." {
+		info = strings.Split(fields[7], ";")
+		for i, item := range info {
+			if strings.HasPrefix(item, "END=") {
+				endItem = i
+			}
+		}
+	}
+	infoEnd := end
+	if endItem >= 0 {
+		if infoEnd, err = strconv.Atoi(strings.TrimPrefix(info[endItem], "END=")); err != nil ||
+			infoEnd < pos {
+			return fmt.Errorf("invalid %s", info[endItem])
+		}
+	}
+	target, beg, _, flipped, err := r.lm.lift(fields[0], pos, max(end, infoEnd))
+	if err != nil {
+		return err
+	}
+	if flipped {
+		if endItem >= 0 {
+			return errLiftEnd
+		}
+		for _, alt := range alts {
+			if alt != "." && alt != "*" && len(alt) != len(ref) {
+				return errLiftIndel
+			}
+		}
+		fields[3] = revcomString(ref)
+		for i, alt := range alts {
+			if alt != "." && alt != "*" {
+				alts[i] = revcomString(alt)
+			}
+		}
+		fields[4] = strings.Join(alts, ",")
+	}
+	if endItem >= 0 {
+		info[endItem] = "END=" + strconv.Itoa(beg+infoEnd-pos)
+		fields[7] = strings.Join(info, ";")
+	}
+	fields[0], fields[1] = target, strconv.Itoa(beg)
+	return nil
+}
+
+// revcomString reverse complements an allele
+func revcomString(s string) string {
+	b := []byte(s)
+	reverseComplement(b)
+	return string(b)
+}
+
+// Run lifts all the records in the input file
+func (r *Lifter) Run() {
+	agp, err := ReadAGPFile(r.AGPfile)
+	ErrorAbort(err)
+	r.lm = newLiftMap(agp, r.Reverse)
+	if r.Format == "" {
+		r.Format = guessFormat(r.Infile)
+	}
+	var liftRecord func([]string) error
+	switch r.Format {
+	case FormatBED:
+		liftRecord = r.liftBED
+	case FormatGFF:
+		liftRecord = r.liftGFF
+	case FormatVCF:
+		liftRecord = r.liftVCF
+	default:
+		ErrorAbort(fmt.Errorf("cannot tell the format of `%s`, use one of bed, gff3, vcf", r.Infile))
+	}
+
+	fh, err := xopen.Ropen(r.Infile)
+	ErrorAbort(err)
+	defer fh.Close()
+	out, err := xopen.Wopen(r.Outfile)
+	ErrorAbort(err)
+	if r.OutUnmappedfile == "" {
+		r.OutUnmappedfile = RemoveExt(strings.TrimSuffix(r.Outfile, ".gz")) + ".unmapped"
+	}
+	unmapped, err := xopen.Wopen(r.OutUnmappedfile)
+	ErrorAbort(err)
+
+	reasons := make(map[string]int)
+	nRecords, nLifted := 0, 0
+	scanner := bufio.NewScanner(fh)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024*1024)
+	for scanner.Scan() {
+		row := scanner.Text()
+		if r.Format == FormatGFF && strings.HasPrefix(row, "##FASTA") {
+			log.Warningf("Sequences after ##FASTA are not lifted")
+			break
+		}
+		if header, ok := r.liftHeader(row); ok {
+			fmt.Fprint(out, header)
+			continue
+		}
+		fields := strings.Split(row, "\t")
+		nRecords++
+		if err := liftRecord(fields); err != nil {
+			reasons[err.Error()]++
+			fmt.Fprintf(unmapped, "#%s\n%s\n", err, row)
+			continue
+		}
+		fmt.Fprintln(out, strings.Join(fields, "\t"))
+		nLifted++
+	}
+	ErrorAbort(scanner.Err())
+	ErrorAbort(out.Close())
+	ErrorAbort(unmapped.Close())
+
+	log.Noticef("Lifted %s records to `%s`", Percentage(nLifted, nRecords), r.Outfile)
+	for reason, count := range reasons {
+		log.Warningf("%d records not lifted: %s", count, reason)
+	}
+	if nLifted < nRecords {
+		log.Noticef("Records not lifted are in `%s`", r.OutUnmappedfile)
+	}
+}
+
+// liftHeader returns the header lines to write for the row, and false if the row is a
+// record. Sequence names in the headers are replaced by the targets.
+func (r *Lifter) liftHeader(row string) (string, bool) {
+	switch r.Format {
+	case FormatBED:
+		if row == "" || row[0] == '#' || strings.HasPrefix(row, "track") ||
+			strings.HasPrefix(row, "browser") {
+			return row + "\n", true
+		}
+	case FormatGFF:
+		if strings.HasPrefix(row, "##sequence-region") {
+			return "", true
+		}
+		if row == "" || row[0] == '#' {
+			return row + "\n", true
+		}
+	case FormatVCF:
+		if strings.HasPrefix(row, "##contig=") {
+			return "", true
+		}
+		if strings.HasPrefix(row, "#CHROM") {
+			var b strings.Builder
+			names, sizes := r.lm.targets()
+			for _, name := range names {
+				if r.Reverse { // Only a lower bound of the contig size is known
+					fmt.Fprintf(&b, "##contig=<ID=%s>\n", name)
+				} else {
+					fmt.Fprintf(&b, "##contig=<ID=%s,length=%d>\n", name, sizes[name])
+				}
+			}
+			return b.String() + row + "\n", true
+		}
+		if row == "" || row[0] == '#' {
+			return row + "\n", true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,154 @@
+/*
+ *  liftover_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/18/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// tig2 is split, with the first half reversed after a gap in s1
+const liftAGP = `s1	1	100	1	W	tig1	1	100	+
+s1	101	200	2	U	100	scaffold	yes	proximity_ligation
+s1	201	250	3	W	tig2	1	50	-
+s2	1	50	1	W	tig2	51	100	+
+`
+
+// runLifter lifts the records and returns the lines in the output and unmapped files
+func runLifter(t *testing.T, input, format string, reverse bool) ([]string, []string) {
+	dir := t.TempDir()
+	agpfile := path.Join(dir, "test.agp")
+	infile := path.Join(dir, "input."+format)
+	for filename, contents := range map[string]string{agpfile: liftAGP, infile: input} {
+		if err := ioutil.WriteFile(filename, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := allhic.Lifter{AGPfile: agpfile, Infile: infile, Reverse: reverse,
+		Outfile: path.Join(dir, "output."+format)}
+	p.Run()
+	var lines [2][]string
+	for i, filename := range []string{p.Outfile, p.OutUnmappedfile} {
+		contents, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := strings.TrimSpace(string(contents)); s != "" {
+			lines[i] = strings.Split(s, "\n")
+		}
+	}
+	return lines[0], lines[1]
+}
+
+func TestLiftoverBED(t *testing.T) {
+	lifted, unmapped := runLifter(t, strings.Join([]string{
+		"track name=test",
+		"tig1\t9\t20\ta\t0\t+",
+		"tig2\t0\t10\tb\t0\t+\t2\t8\t0\t2\t3,2\t0,8",
+		"tig2\t60\t70\tc\t0\t-",
+		"tig2\t40\t60\td\t0\t+",
+		"tig9\t0\t10\te\t0\t+",
+	}, "\n")+"\n", "bed", false)
+	expected := []string{
+		"track name=test",
+		"s1\t9\t20\ta\t0\t+",
+		"s1\t240\t250\tb\t0\t-\t242\t248\t0\t2\t2,3\t0,7",
+		"s2\t10\t20\tc\t0\t-",
+	}
+	if strings.Join(lifted, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Expected\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(lifted, "\n"))
+	}
+	if len(unmapped) != 4 || !strings.Contains(unmapped[0], "more than one component") ||
+		!strings.Contains(unmapped[2], "not in the AGP") {
+		t.Fatalf("Unexpected unmapped records %v", unmapped)
+	}
+
+	// And back to the contigs, except the one across the gap
+	lifted, unmapped = runLifter(t, "s1\t240\t250\tb\t0\t-\ns1\t90\t110\tf\t0\t+\n", "bed", true)
+	if len(lifted) != 1 || lifted[0] != "tig2\t0\t10\tb\t0\t+" {
+		t.Fatalf("Unexpected records lifted back %v", lifted)
+	}
+	if len(unmapped) != 2 || !strings.Contains(unmapped[0], "spans a gap") {
+		t.Fatalf("Expected the record across the gap to be unmapped, got %v", unmapped)
+	}
+}
+
+func TestLiftoverGFF(t *testing.T) {
+	lifted, _ := runLifter(t, "##gff-version 3\n##sequence-region tig2 1 100\n"+
+		"tig2\t.\tgene\t1\t10\t.\t+\t.\tID=g1\n", "gff3", false)
+	expected := "##gff-version 3\ns1\t.\tgene\t241\t250\t.\t-\t.\tID=g1"
+	if strings.Join(lifted, "\n") != expected {
+		t.Fatalf("Expected\n%s\ngot\n%s", expected, strings.Join(lifted, "\n"))
+	}
+}
+
+func TestLiftoverVCF(t *testing.T) {
+	lifted, unmapped := runLifter(t, strings.Join([]string{
+		"##fileformat=VCFv4.2",
+		"##contig=<ID=tig1,length=100>",
+		"#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO",
+		"tig1\t5\t.\tAC\tA\t.\t.\t.",
+		"tig2\t5\t.\tA\tG,T\t.\t.\t.",
+		"tig2\t5\t.\tAC\tA\t.\t.\t.",
+	}, "\n")+"\n", "vcf", false)
+	expected := []string{
+		"##fileformat=VCFv4.2",
+		"##contig=<ID=s1,length=250>",
+		"##contig=<ID=s2,length=50>",
+		"#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO",
+		"s1\t5\t.\tAC\tA\t.\t.\t.",
+		"s1\t246\t.\tT\tC,A\t.\t.\t.",
+	}
+	if strings.Join(lifted, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Expected\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(lifted, "\n"))
+	}
+	if len(unmapped) != 2 || !strings.Contains(unmapped[0], "indel") {
+		t.Fatalf("Expected the indel on the '-' component to be unmapped, got %v", unmapped)
+	}
+}
+
+func TestLiftoverBEDInsertion(t *testing.T) {
+	lifted, unmapped := runLifter(t, strings.Join([]string{
+		"tig1\t50\t50\ta",
+		"tig1\t100\t100\tb", // At the end, lifted with the base to its left
+		"tig2\t10\t10\tc",
+	}, "\n")+"\n", "bed", false)
+	expected := []string{
+		"s1\t50\t50\ta",
+		"s1\t100\t100\tb",
+		"s1\t240\t240\tc",
+	}
+	if strings.Join(lifted, "\n") != strings.Join(expected, "\n") || len(unmapped) != 0 {
+		t.Fatalf("Expected\n%s\ngot\n%s\nand unmapped %v", strings.Join(expected, "\n"),
+			strings.Join(lifted, "\n"), unmapped)
+	}
+}
+
+func TestLiftoverVCFEnd(t *testing.T) {
+	lifted, unmapped := runLifter(t, strings.Join([]string{
+		"#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO",
+		"tig1\t5\t.\tA\t<DEL>\t.\t.\tSVTYPE=DEL;END=20",
+		"tig2\t60\t.\tA\t<NON_REF>\t.\t.\tEND=70",
+		"tig2\t5\t.\tA\t<NON_REF>\t.\t.\tEND=10",
+	}, "\n")+"\n", "vcf", false)
+	expected := []string{
+		"s1\t5\t.\tA\t<DEL>\t.\t.\tSVTYPE=DEL;END=20",
+		"s2\t10\t.\tA\t<NON_REF>\t.\t.\tEND=20",
+	}
+	if strings.Join(lifted[len(lifted)-2:], "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Expected\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(lifted, "\n"))
+	}
+	if len(unmapped) != 2 || !strings.Contains(unmapped[0], "END") {
+		t.Fatalf("Expected the record with END on the '-' component to be unmapped, got %v", unmapped)
+	}
+}
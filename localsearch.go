@@ -0,0 +1,248 @@
+/*
+ *  localsearch.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/18/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+)
+
+// Alternatives to GA for the ordering of contigs. All the moves are scored with the
+// deltas in delta.go, so each optimizer uses the same objective as Tour.Evaluate.
+
+const (
+	// MethodGA evolves the tours with the Genetic Algorithm
+	MethodGA = "ga"
+	// MethodSA perturbs the tour with simulated annealing
+	MethodSA = "sa"
+	// Method2Opt reverses segments until no reversal improves the tour
+	Method2Opt = "2opt"
+	// MethodOrOpt moves blocks of up to 3 contigs until no move improves the tour
+	MethodOrOpt = "oropt"
+	// MethodMemetic runs GA and then polishes the best tour with 2-opt and Or-opt
+	MethodMemetic = "memetic"
+	// MethodExact finds the optimal tour by branch-and-bound, only feasible for small groups
+	MethodExact = "exact"
+)
+
+const (
+	// saCooling is the factor applied to the temperature after each epoch
+	saCooling = 0.99
+	// saMinTemp is the temperature, relative to the initial one, where we stop
+	saMinTemp = 1e-6
+	// orOptMaxBlock is the largest number of contigs moved together in Or-opt
+	orOptMaxBlock = 3
+)
+
+// validMethod checks the name of the ordering optimizer
+func validMethod(method string) error {
+	switch method {
+	case MethodGA, MethodSA, Method2Opt, MethodOrOpt, MethodMemetic, MethodExact:
+		return nil
+	}
+	return fmt.Errorf("unknown method `%s`, choose from %s, %s, %s, %s, %s, %s",
+		method, MethodGA, MethodSA, Method2Opt, MethodOrOpt, MethodMemetic, MethodExact)
+}
+
+// improves tells if a delta is a real improvement rather than rounding noise
+func improves(delta, score float64) bool {
+	return delta < -1e-12*math.Max(1, math.Abs(score))
+}
+
+// twoOpt tries to reverse every segment of the tour and keeps the reversals that
+// improve the score, returns the total change in score
+func (r Tour) twoOpt() float64 {
+	total := 0.0
+	score, _ := r.scorer().Score(r)
+	n := r.Len()
+	for p := 0; p < n; p++ {
+		for q := p + 1; q < n; q++ {
+			delta := r.MutInversionDelta(p, q)
+			if improves(delta, score) {
+				score += delta
+				total += delta
+			} else {
+				invert(r, p, q) // Undo
+			}
+		}
+	}
+	return total
+}
+
+// moveBlock moves the block [i, i+k-1] to right after position j (or right before
+// when j < i), optionally reversing the block, and returns the change in score
+// together with the function that undoes the move. The move is a composition of
+// reversals.
+func (r Tour) moveBlock(i, k, j int, reverse bool) (float64, func()) {
+	var segments [][2]int
+	if j > i {
+		if !reverse {
+			segments = append(segments, [2]int{i, i + k - 1})
+		}
+		segments = append(segments, [2]int{i + k, j}, [2]int{i, j})
+	} else {
+		segments = append(segments, [2]int{j, i - 1})
+		if !reverse {
+			segments = append(segments, [2]int{i, i + k - 1})
+		}
+		segments = append(segments, [2]int{j, i + k - 1})
+	}
+	delta := 0.0
+	for _, s := range segments {
+		delta += r.MutInversionDelta(s[0], s[1])
+	}
+	return delta, func() {
+		for m := len(segments) - 1; m >= 0; m-- {
+			invert(r, segments[m][0], segments[m][1])
+		}
+	}
+}
+
+// orOpt tries to move every block of up to orOptMaxBlock contigs to every other
+// position, in both orientations, and keeps the moves that improve the score,
+// returns the total change in score
+func (r Tour) orOpt() float64 {
+	total := 0.0
+	score, _ := r.scorer().Score(r)
+	n := r.Len()
+	for k := 1; k <= orOptMaxBlock && k < n; k++ {
+		reverses := []bool{false}
+		if k > 1 || r.oriented() { // Reversing a single contig only changes its sign
+			reverses = append(reverses, true)
+		}
+		for i := 0; i+k <= n; i++ {
+			for j := 0; j < n; j++ {
+				if j >= i && j <= i+k-1 { // Within the block
+					continue
+				}
+				for _, reverse := range reverses {
+					delta, undo := r.moveBlock(i, k, j, reverse)
+					if improves(delta, score) {
+						score += delta
+						total += delta
+						break
+					}
+					undo()
+				}
+			}
+		}
+	}
+	return total
+}
+
+// LocalSearchRun applies the moves repeatedly to the current tour until none of them
+// improves the score
+func (r *CLM) LocalSearchRun(fwtour *os.File, label string, phase int,
+	moves ...func(Tour) float64) Tour {
+	tour := r.Tour.Clone().(Tour)
+	if tour.Len() < 2 {
+		return r.Tour
+	}
+	score, _ := tour.scorer().Score(tour)
+	log.Noticef("%s initialized (score: %.5f)", label, -score)
+	for sweep := 1; ; sweep++ {
+		total := 0.0
+		for _, move := range moves {
+			total += move(tour)
+		}
+		score += total
+		fmt.Printf("Current iteration %s%d-%d: max_score=%.5f\n", label, phase, sweep, -score)
+		r.printTour(fwtour, tour, fmt.Sprintf("%s%d-%d-%.5f", label, phase, sweep, -score))
+		if !improves(total, score) {
+			break
+		}
+	}
+	r.Tour = tour
+	return r.Tour
+}
+
+// randomMove applies a random inversion, insertion, swap or flip (if the tour is
+// oriented), and returns the change in score and the function that undoes the move
+func (r Tour) randomMove(rng *rand.Rand) (float64, func()) {
+	nMoves := 3
+	if r.oriented() {
+		nMoves = 4
+	}
+	kind := rng.Intn(nMoves)
+	if kind == 3 {
+		i := rng.Intn(r.Len())
+		return r.MutFlipDelta(i), func() { r.Flip(i) }
+	}
+	p, q := randomTwoInts(r, rng)
+	if p == q {
+		return 0, func() {}
+	}
+	switch kind {
+	case 0:
+		return r.MutInversionDelta(p, q), func() { invert(r, p, q) }
+	case 1:
+		toFront := rng.Float64() < .5
+		return r.MutInsertionDelta(p, q, toFront), func() { insert(r, p, q, !toFront) }
+	default:
+		return r.MutPermuteDelta(p, q), func() { r.Swap(p, q) }
+	}
+}
+
+// initialTemperature samples random moves and takes the mean absolute change in score
+// as the starting temperature, so that most moves are accepted at first
+func (r Tour) initialTemperature(rng *rand.Rand) float64 {
+	sum := 0.0
+	nSamples := 100
+	for i := 0; i < nSamples; i++ {
+		delta, undo := r.randomMove(rng)
+		undo()
+		sum += math.Abs(delta)
+	}
+	return sum / float64(nSamples)
+}
+
+// SARun optimizes the ordering with simulated annealing. Each epoch tries as many
+// random moves as there are contigs, then the temperature is lowered. We stop when
+// the best tour has not been improved in NGen epochs, or when the temperature is
+// too low to accept any worse tour.
+func (r *CLM) SARun(fwtour *os.File, opt *Optimizer, phase int) Tour {
+	tour := r.Tour.Clone().(Tour)
+	n := tour.Len()
+	if n < 2 {
+		return r.Tour
+	}
+	score, _ := tour.scorer().Score(tour)
+	best, bestScore := tour.Clone().(Tour), score
+	temp := tour.initialTemperature(opt.rng)
+	minTemp := temp * saMinTemp
+	log.Noticef("SA initialized (ngen: %v, rng: %d, break: %d, maxgen: %d, temperature: %.5g, oriented: %v)",
+		opt.NGen, opt.Seed, opt.Limit, opt.MaxGen, temp, tour.oriented())
+
+	updated := 0
+	epoch := 1
+	for ; epoch <= opt.MaxGen && epoch-updated <= opt.NGen && temp > minTemp; epoch++ {
+		for i := 0; i < n; i++ {
+			delta, undo := tour.randomMove(opt.rng)
+			if delta > 0 && opt.rng.Float64() >= math.Exp(-delta/temp) {
+				undo()
+				continue
+			}
+			score += delta
+			if improves(score-bestScore, bestScore) {
+				best, bestScore = tour.Clone().(Tour), score
+				updated = epoch
+			}
+		}
+		temp *= saCooling
+		if epoch%500 == 0 {
+			fmt.Printf("Current iteration SA%d-%d: max_score=%.5f\n", phase, epoch, -bestScore)
+			r.printTour(fwtour, best, fmt.Sprintf("SA%d-%d-%.5f", phase, epoch, -bestScore))
+		}
+	}
+	r.printTour(fwtour, best, fmt.Sprintf("SA%d-%d-%.5f", phase, epoch-1, -bestScore))
+	r.Tour = best
+	return r.Tour
+}
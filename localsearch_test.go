@@ -0,0 +1,168 @@
+/*
+ *  localsearch_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/18/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// writeSmallREfile writes a small group made of the first n tigs in the simulation
+func writeSmallREfile(t *testing.T, n int) string {
+	ids, err := ioutil.ReadFile(path.Join("tests", "simulation", "test.ids"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	refile := path.Join(t.TempDir(), "small.ids")
+	lines := strings.SplitAfter(string(ids), "\n")
+	if err := ioutil.WriteFile(refile, []byte(strings.Join(lines[:n+1], "")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return refile
+}
+
+// newScoredCLM loads the group with the given score and a shuffled tour
+func newScoredCLM(t *testing.T, refile, score, distfile string) *allhic.CLM {
+	clm := allhic.NewCLM(path.Join("tests", "simulation", "test.clm"), refile)
+	scorer, err := allhic.NewScorer(score, distfile, clm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clm.Tour.Limit = allhic.LIMIT
+	clm.Tour.Scorer = scorer
+	clm.Activate(true, rand.New(rand.NewSource(42)))
+	return clm
+}
+
+// movedBlock builds the expected tour after moving the block [i, i+k-1] after j, or
+// before j when j < i
+func movedBlock(tigs []allhic.Tig, i, k, j int, reverse, oriented bool) []allhic.Tig {
+	block := make([]allhic.Tig, k)
+	copy(block, tigs[i:i+k])
+	if reverse {
+		for a, b := 0, k-1; a < b; a, b = a+1, b-1 {
+			block[a], block[b] = block[b], block[a]
+		}
+		for m := range block {
+			if oriented {
+				block[m].Sign = map[byte]byte{'+': '-', '-': '+'}[block[m].Sign]
+			}
+		}
+	}
+	var rest []allhic.Tig
+	rest = append(rest, tigs[:i]...)
+	rest = append(rest, tigs[i+k:]...)
+	at := j
+	if j > i {
+		at = j - k + 1
+	}
+	var moved []allhic.Tig
+	moved = append(moved, rest[:at]...)
+	moved = append(moved, block...)
+	return append(moved, rest[at:]...)
+}
+
+func TestMoveBlock(t *testing.T) {
+	distfile := writeTestDistribution(t)
+	for _, score := range []string{allhic.ScoreRecip, allhic.ScoreSumLog,
+		allhic.ScoreLikelihood, allhic.ScoreML} {
+		tour := newScoredCLM(t, path.Join("tests", "simulation", "test.ids"), score, distfile).Tour
+		oriented := score == allhic.ScoreML
+		rng := rand.New(rand.NewSource(42))
+		n := tour.Len()
+		for m := 0; m < 200; m++ {
+			k := 1 + rng.Intn(3)
+			i := rng.Intn(n - k + 1)
+			j := rng.Intn(n)
+			if i <= j && j < i+k {
+				continue
+			}
+			reverse := rng.Intn(2) == 0
+			original := make([]allhic.Tig, n)
+			copy(original, tour.Tigs)
+			before, _ := tour.Scorer.Score(tour)
+
+			delta, undo := tour.MoveBlock(i, k, j, reverse)
+			expected := movedBlock(original, i, k, j, reverse, oriented)
+			if !reflect.DeepEqual(tour.Tigs, expected) {
+				t.Fatalf("%s: unexpected tour after moving [%d, %d] to %d (reverse=%v)",
+					score, i, i+k-1, j, reverse)
+			}
+			checkScore(t, score+" moveBlock", before+delta, tour)
+
+			undo()
+			if !reflect.DeepEqual(tour.Tigs, original) {
+				t.Fatalf("%s: undo did not restore the tour after moving [%d, %d] to %d",
+					score, i, i+k-1, j)
+			}
+			checkScore(t, score+" undo", before, tour)
+		}
+	}
+}
+
+func TestRandomMove(t *testing.T) {
+	distfile := writeTestDistribution(t)
+	for _, score := range []string{allhic.ScoreRecip, allhic.ScoreML} {
+		tour := newScoredCLM(t, path.Join("tests", "simulation", "test.ids"), score, distfile).Tour
+		rng := rand.New(rand.NewSource(42))
+		for m := 0; m < 200; m++ {
+			original := make([]allhic.Tig, tour.Len())
+			copy(original, tour.Tigs)
+			before, _ := tour.Scorer.Score(tour)
+			delta, undo := tour.RandomMove(rng)
+			checkScore(t, score+" randomMove", before+delta, tour)
+			undo()
+			if !reflect.DeepEqual(tour.Tigs, original) {
+				t.Fatalf("%s: undo did not restore the tour after move %d", score, m)
+			}
+		}
+	}
+}
+
+func TestLocalSearchNotWorse(t *testing.T) {
+	distfile := writeTestDistribution(t)
+	fwtour, err := os.Create(path.Join(t.TempDir(), "test.tour"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fwtour.Close()
+	refile := writeSmallREfile(t, 30)
+	for _, score := range []string{allhic.ScoreRecip, allhic.ScoreML} {
+		for _, method := range []string{allhic.MethodSA, allhic.Method2Opt, allhic.MethodOrOpt} {
+			clm := newScoredCLM(t, refile, score, distfile)
+			before, _ := clm.Tour.Scorer.Score(clm.Tour)
+			switch method {
+			case allhic.MethodSA:
+				opt := allhic.Optimizer{Seed: 42, NGen: 50, MaxGen: 1000, Limit: allhic.LIMIT}
+				opt.SeedRNG()
+				clm.SARun(fwtour, &opt, 1)
+			case allhic.Method2Opt:
+				clm.LocalSearchRun(fwtour, "2OPT", 1, allhic.TwoOpt)
+			default:
+				clm.LocalSearchRun(fwtour, "OROPT", 1, allhic.OrOpt)
+			}
+			after, _ := clm.Tour.Scorer.Score(clm.Tour)
+			if after > before+1e-6*math.Abs(before) {
+				t.Fatalf("%s with %s: score went from %.5f to %.5f", method, score, -before, -after)
+			}
+			if after >= before {
+				t.Fatalf("%s with %s: expected the shuffled tour to improve from %.5f", method,
+					score, -before)
+			}
+		}
+	}
+}
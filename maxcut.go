@@ -0,0 +1,360 @@
+/*
+ *  maxcut.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/18/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// Orientation solvers beyond the leading eigenvector of O and the single flips. The
+// signs x maximize x'Ox, a max-cut problem. We round a low-rank relaxation the way of
+// Goemans-Williamson, and refine with a Kernighan-Lin style search that also flips
+// adjacent pairs. Either one is only kept if evaluateOrientations (i.e. EvaluateQ
+// unless the Scorer is aware of orientations) improves.
+
+const (
+	// OrientEigen initializes the signs with the leading eigenvector of O
+	OrientEigen = "eigen"
+	// OrientGW rounds a low-rank relaxation of max-cut with random hyperplanes
+	OrientGW = "gw"
+	// OrientOne flips each contig in turn and keeps the flips that improve the score
+	OrientOne = "one"
+	// OrientKL flips contigs and adjacent pairs of contigs in Kernighan-Lin passes
+	OrientKL = "kl"
+)
+
+const (
+	// gwRank is the dimension of the vectors in the relaxation
+	gwRank = 8
+	// gwMaxSweeps caps the number of coordinate ascent sweeps in the relaxation
+	gwMaxSweeps = 1000
+	// gwRounds is the number of random hyperplanes tried in the rounding
+	gwRounds = 100
+	// klMaxPasses caps the number of Kernighan-Lin passes
+	klMaxPasses = 10
+)
+
+// validOrient checks the names of the orientation solvers
+func validOrient(init, search string) error {
+	if init != OrientEigen && init != OrientGW {
+		return fmt.Errorf("unknown orientinit `%s`, choose from %s, %s", init, OrientEigen, OrientGW)
+	}
+	if search != OrientOne && search != OrientKL {
+		return fmt.Errorf("unknown orientsearch `%s`, choose from %s, %s", search, OrientOne, OrientKL)
+	}
+	return nil
+}
+
+// signEdge is an entry of O, between a contig and the contig at position j in the tour
+type signEdge struct {
+	j int
+	w float64
+}
+
+// signGraph is the sparse O restricted to the tigs in the tour, indexed by position
+func (r *CLM) signGraph() [][]signEdge {
+	pos := make(map[int]int)
+	for i, t := range r.Tour.Tigs {
+		pos[t.Idx] = i
+	}
+	O := r.O()
+	graph := make([][]signEdge, r.Tour.Len())
+	for i, t := range r.Tour.Tigs {
+		cols, vals := O.row(t.Idx)
+		for k, col := range cols {
+			if j, ok := pos[col]; ok && j != i {
+				graph[i] = append(graph[i], signEdge{j, vals[k]})
+			}
+		}
+	}
+	return graph
+}
+
+// relaxSigns maximizes Sum O_ij <v_i, v_j> over unit vectors v_i of dimension gwRank,
+// by moving each vector to the direction of its weighted neighbors until convergence
+func relaxSigns(graph [][]signEdge, rng *rand.Rand) [][]float64 {
+	n := len(graph)
+	v := make([][]float64, n)
+	for i := range v {
+		v[i] = make([]float64, gwRank)
+		for k := range v[i] {
+			v[i][k] = rng.NormFloat64()
+		}
+		normalize(v[i])
+	}
+	u := make([]float64, gwRank)
+	for sweep := 0; sweep < gwMaxSweeps; sweep++ {
+		change := 0.0
+		for i, edges := range graph {
+			for k := range u {
+				u[k] = 0
+			}
+			for _, e := range edges {
+				for k := range u {
+					u[k] += e.w * v[e.j][k]
+				}
+			}
+			if normalize(u) == 0 {
+				continue // No neighbors, any direction is as good
+			}
+			for k := range u {
+				change += math.Abs(u[k] - v[i][k])
+				v[i][k] = u[k]
+			}
+		}
+		if change < 1e-9*float64(n) {
+			break
+		}
+	}
+	return v
+}
+
+// normalize scales the vector to unit length, and returns its original length
+func normalize(u []float64) float64 {
+	norm := 0.0
+	for _, x := range u {
+		norm += x * x
+	}
+	norm = math.Sqrt(norm)
+	if norm > 0 {
+		for k := range u {
+			u[k] /= norm
+		}
+	}
+	return norm
+}
+
+// cutValue computes x'Ox for the signs x
+func cutValue(graph [][]signEdge, signs []byte) float64 {
+	value := 0.0
+	for i, edges := range graph {
+		for _, e := range edges {
+			if signs[i] == signs[e.j] {
+				value += e.w
+			} else {
+				value -= e.w
+			}
+		}
+	}
+	return value
+}
+
+// flipGW rounds the relaxation with random hyperplanes, keeps the signs with the
+// largest x'Ox (or their reverse), and accepts them if they score better than the
+// current signs
+func (r *CLM) flipGW(rng *rand.Rand) (tag string) {
+	oldSigns := r.Tour.Signs()
+	score := r.evaluateOrientations()
+
+	graph := r.signGraph()
+	v := relaxSigns(graph, rng)
+	best := oldSigns
+	bestValue := cutValue(graph, oldSigns)
+	signs := make([]byte, len(v))
+	h := make([]float64, gwRank)
+	for round := 0; round < gwRounds; round++ {
+		for k := range h {
+			h[k] = rng.NormFloat64()
+		}
+		for i := range v {
+			dot := 0.0
+			for k := range h {
+				dot += h[k] * v[i][k]
+			}
+			signs[i] = '+'
+			if dot < 0 {
+				signs[i] = '-'
+			}
+		}
+		if value := cutValue(graph, signs); value > bestValue {
+			best = append([]byte{}, signs...)
+			bestValue = value
+		}
+	}
+
+	// x and -x have the same x'Ox, but not the same score
+	r.Tour.SetSigns(best)
+	newScore := r.evaluateOrientations()
+	for i := range best {
+		r.Tour.Flip(i)
+	}
+	if reversedScore := r.evaluateOrientations(); reversedScore > newScore {
+		newScore = reversedScore
+	} else {
+		r.Tour.SetSigns(best)
+	}
+	tag = ACCEPT
+	if newScore <= score {
+		r.Tour.SetSigns(oldSigns) // Recover
+		tag = REJECT
+	}
+	flipLog("FLIPGW", score, newScore, tag)
+	return
+}
+
+// qAround sums the terms of EvaluateQ that involve the i-th tig, with the same
+// distances as in EvaluateQ
+func (r *CLM) qAround(starts []int, i int) float64 {
+	tour := r.Tour
+	ti := tour.Tigs[i]
+	score := 0.0
+	add := func(a, b Tig, dist int) {
+		gdists, ok := r.orientedContacts[OrientedPair{a.Idx, b.Idx, a.Sign, b.Sign}]
+		if !ok {
+			return
+		}
+		for k := 0; k < BB; k++ {
+			score -= float64(gdists[k]) * math.Log(float64(GR[k]+dist))
+		}
+	}
+	for j := i - 1; j >= 0; j-- {
+		dist := starts[i-1] - starts[j]
+		if dist > tour.Limit {
+			break
+		}
+		add(tour.Tigs[j], ti, dist)
+	}
+	for j := i + 1; j < tour.Len(); j++ {
+		dist := starts[j-1] - starts[i]
+		if dist > tour.Limit {
+			break
+		}
+		add(ti, tour.Tigs[j], dist)
+	}
+	return score
+}
+
+// flipGain is the change in evaluateOrientations when flipping the i-th tig, the
+// tour is left unchanged
+func (r *CLM) flipGain(starts []int, i int) float64 {
+	if _, ok := r.Tour.Scorer.(orientationAware); ok {
+		delta := r.Tour.MutFlipDelta(i)
+		r.Tour.Flip(i)
+		return -delta
+	}
+	before := r.qAround(starts, i)
+	r.Tour.Flip(i)
+	after := r.qAround(starts, i)
+	r.Tour.Flip(i)
+	return after - before
+}
+
+// klMove flips the tig at i, or the tigs at i and i+1 together if pair
+type klMove struct {
+	i    int
+	pair bool
+}
+
+// apply flips the tigs in the move
+func (m klMove) apply(tour Tour) {
+	tour.Flip(m.i)
+	if m.pair {
+		tour.Flip(m.i + 1)
+	}
+}
+
+// klGain is the change in evaluateOrientations when applying the move
+func (r *CLM) klGain(starts []int, m klMove) float64 {
+	gain := r.flipGain(starts, m.i)
+	if m.pair {
+		r.Tour.Flip(m.i)
+		gain += r.flipGain(starts, m.i+1)
+		r.Tour.Flip(m.i)
+	}
+	return gain
+}
+
+// klPass applies the best move among those that do not touch a flipped tig, until
+// no move is left, then rolls back to the best point in the sequence. The moves are
+// applied even when they lower the score, so that the pass can climb out of the local
+// optima of flipOne. Returns the total gain.
+func (r *CLM) klPass(starts []int) float64 {
+	n := r.Tour.Len()
+	var moves []klMove
+	for i := 0; i < n; i++ {
+		moves = append(moves, klMove{i, false})
+		if i+1 < n {
+			moves = append(moves, klMove{i, true})
+		}
+	}
+	gains := make([]float64, len(moves))
+	for k, m := range moves {
+		gains[k] = r.klGain(starts, m)
+	}
+	// The gains only change for the moves with a tig within the limit of a flipped
+	// tig, the distances in EvaluateQ and the pairs add up to a few tig sizes
+	maxSize := 0
+	for _, t := range r.Tour.Tigs {
+		maxSize = max(maxSize, t.Size)
+	}
+	reach := r.Tour.Limit + 3*maxSize
+
+	locked := make([]bool, n)
+	var applied []klMove
+	total, bestTotal, bestLen := 0.0, 0.0, 0
+	for {
+		best := -1
+		for k, m := range moves {
+			if locked[m.i] || (m.pair && locked[m.i+1]) {
+				continue
+			}
+			if best < 0 || gains[k] > gains[best] {
+				best = k
+			}
+		}
+		if best < 0 {
+			break
+		}
+		m := moves[best]
+		m.apply(r.Tour)
+		locked[m.i] = true
+		if m.pair {
+			locked[m.i+1] = true
+		}
+		applied = append(applied, m)
+		total += gains[best]
+		if total > bestTotal+1e-9*math.Max(1, math.Abs(bestTotal)) {
+			bestTotal, bestLen = total, len(applied)
+		}
+		for k, o := range moves {
+			if locked[o.i] || (o.pair && locked[o.i+1]) {
+				continue
+			}
+			if abs(starts[o.i]-starts[m.i]) <= reach {
+				gains[k] = r.klGain(starts, o)
+			}
+		}
+	}
+	for k := len(applied) - 1; k >= bestLen; k-- {
+		applied[k].apply(r.Tour) // Undo
+	}
+	return bestTotal
+}
+
+// flipKL runs Kernighan-Lin passes until a pass no longer improves the score
+func (r *CLM) flipKL() (tag string) {
+	score := r.evaluateOrientations()
+	starts := r.Tour.starts()
+	nPasses := 0
+	for nPasses < klMaxPasses {
+		nPasses++
+		if r.klPass(starts) <= 0 {
+			break
+		}
+	}
+	newScore := r.evaluateOrientations()
+	tag = REJECT
+	if newScore > score {
+		tag = ACCEPT
+	}
+	flipLog(fmt.Sprintf("FLIPKL (%d passes)", nPasses), score, newScore, tag)
+	return
+}
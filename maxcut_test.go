@@ -0,0 +1,74 @@
+/*
+ *  maxcut_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/18/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+func TestFlipKL(t *testing.T) {
+	clm := allhic.NewCLM(path.Join("tests", "simulation", "test.clm"),
+		path.Join("tests", "simulation", "test.ids"))
+	clm.Tour.Limit = allhic.LIMIT
+	clm.Activate(true, rand.New(rand.NewSource(42)))
+	before := clm.EvaluateQ()
+
+	fwtour, err := os.Create(path.Join(t.TempDir(), "test.tour"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fwtour.Close()
+	clm.OptimizeOrientations(fwtour, &allhic.Optimizer{OrientSearch: allhic.OrientKL}, 1)
+	after := clm.EvaluateQ()
+	if after < before {
+		t.Fatalf("EvaluateQ got worse after KL: %.5f => %.5f", before, after)
+	}
+
+	// No single flip, nor flip of two adjacent tigs, may improve the result
+	tour := clm.Tour
+	for i := 0; i < tour.Len(); i++ {
+		for _, k := range []int{i, i + 1} {
+			if k >= tour.Len() {
+				continue
+			}
+			for j := i; j <= k; j++ {
+				tour.Flip(j)
+			}
+			if score := clm.EvaluateQ(); score > after+1e-6 {
+				t.Fatalf("Flipping tigs %d to %d improves %.5f => %.5f", i, k, after, score)
+			}
+			for j := i; j <= k; j++ {
+				tour.Flip(j)
+			}
+		}
+	}
+}
+
+func TestOptimizeOrientGW(t *testing.T) {
+	p := allhic.Optimizer{REfile: copyREfile(t),
+		Clmfile: path.Join("tests", "simulation", "test.clm"),
+		Seed:    42, NPop: 20, NGen: 50, MutProb: .2,
+		OrientInit: allhic.OrientGW, OrientSearch: allhic.OrientKL}
+	p.Run()
+	tour, err := ioutil.ReadFile(p.OutTourFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(tour), "orientinit=gw orientsearch=kl") ||
+		!strings.Contains(string(tour), ">FLIPKL1\n") {
+		t.Fatalf("Unexpected tour file:\n%s", tour)
+	}
+}
@@ -11,9 +11,11 @@ package allhic
 
 import (
 	"bufio"
+	"encoding/csv"
 	"fmt"
 	"math"
 	"os"
+	"strconv"
 )
 
 // LinkDensityModel is a power-law model Y = A * X ^ B, stores co-efficients
@@ -45,7 +47,7 @@ func (r *LinkDensityModel) writeDistribution(outfile string) {
 	w := bufio.NewWriter(f)
 
 	_, _ = fmt.Fprintf(w, DistributionHeader)
-	for i := 0; i < nBins; i++ {
+	for i := range r.nLinks {
 		_, _ = fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%d\t%.4g\n",
 			i, r.binStarts[i], r.BinSize(i), r.nLinks[i], r.binNorms[i], r.linkDensity[i])
 	}
@@ -55,6 +57,109 @@ func (r *LinkDensityModel) writeDistribution(outfile string) {
 	_ = f.Close()
 }
 
+// readDistribution parses the link size distribution written by writeDistribution,
+// the power law is re-fitted on the bins that have links
+func readDistribution(distfile string) (*LinkDensityModel, error) {
+	fh, err := os.Open(distfile)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	reader := csv.NewReader(bufio.NewReader(fh))
+	reader.Comma = '\t'
+	reader.FieldsPerRecord = 6
+	recs, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse `%s`: %v", distfile, err)
+	}
+	if len(recs) > 0 {
+		recs = recs[1:] // Skip header
+	}
+	r := &LinkDensityModel{
+		binStarts:   make([]int, len(recs)+1),
+		binNorms:    make([]int, len(recs)),
+		nLinks:      make([]int, len(recs)),
+		linkDensity: make([]float64, len(recs)),
+	}
+	Xs := make([]int, 0)
+	Ys := make([]float64, 0)
+	for i, rec := range recs {
+		var values [4]int
+		for k := range values {
+			if values[k], err = strconv.Atoi(rec[k+1]); err != nil {
+				return nil, fmt.Errorf("cannot parse line %d of `%s`: %v", i+2, distfile, err)
+			}
+		}
+		binStart, binSize := values[0], values[1]
+		r.binStarts[i] = binStart
+		r.binStarts[i+1] = binStart + binSize
+		r.nLinks[i], r.binNorms[i] = values[2], values[3]
+		if r.linkDensity[i], err = strconv.ParseFloat(rec[5], 64); err != nil {
+			return nil, fmt.Errorf("cannot parse line %d of `%s`: %v", i+2, distfile, err)
+		}
+		if r.nLinks[i] > 0 && r.linkDensity[i] > 0 {
+			Xs = append(Xs, binStart)
+			Ys = append(Ys, r.linkDensity[i])
+		}
+	}
+	if len(Xs) < 2 {
+		return nil, fmt.Errorf("not enough links in `%s` to fit the power law", distfile)
+	}
+	r.fitPowerLaw(Xs, Ys)
+	return r, nil
+}
+
+// expectedInterContigLinks calculates the expected number of links in each bin between
+// two contigs of sizes L1 and L2 separated by a gap of D
+func (r *LinkDensityModel) expectedInterContigLinks(D, L1, L2 int) []float64 {
+	if L1 > L2 {
+		L1, L2 = L2, L1
+	}
+	nExpectedLinks := make([]float64, len(r.linkDensity))
+
+	for i := range nExpectedLinks {
+		binStart := r.binStarts[i]
+		binStop := r.binStarts[i+1]
+
+		if binStop <= D {
+			continue
+		}
+		if binStart >= D+L1+L2 {
+			break
+		}
+
+		nObservableLinks := 0
+
+		// If the bin falls along the left slope of the trapezoid
+		if binStart < D+L1 {
+			left := max(binStart, D)
+			right := min(binStop, D+L1)
+			middleX := (left + right) / 2
+			middleY := middleX - D
+			nObservableLinks += (right - left) * middleY
+		}
+
+		// If the bin falls along the flat middle of the trapezoid
+		if binStop >= D+L1 && binStart < D+L2 {
+			left := max(binStart, D+L1)
+			right := min(binStop, D+L2)
+			nObservableLinks += (right - left) * L1
+		}
+
+		// If the bin falls along the right slope of the trapezoid
+		if binStop >= D+L2 {
+			left := max(binStart, D+L2)
+			right := min(binStop, D+L1+L2)
+			middleX := (left + right) / 2
+			middleY := D + L1 + L2 - middleX
+			nObservableLinks += (right - left) * middleY
+		}
+		nExpectedLinks[i] = float64(nObservableLinks) * r.linkDensity[i]
+	}
+
+	return nExpectedLinks
+}
+
 // linkBin takes a link distance and convert to a binID
 func (r *LinkDensityModel) linkBin(dist int) int {
 	if dist < MinLinkDist {
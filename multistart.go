@@ -0,0 +1,121 @@
+/*
+ *  multistart.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/18/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+)
+
+// startResult keeps the outcome of one start in the multi-start mode
+type startResult struct {
+	seed     int64
+	tourfile string
+	clm      *CLM
+	score    float64
+}
+
+// multiStart runs optimize with NStarts consecutive seeds and keeps the tour with
+// the best score on the oriented tour. The history of each start goes to its own tour
+// file in the .starts directory, and the best one is copied to tourfile. The support
+// of the adjacencies in the best tour across all starts is written to the consensus
+// file.
+func (r *Optimizer) multiStart(tourfile, resumeFile string) {
+	startsDir := RemoveExt(tourfile) + ".starts"
+	ErrorAbort(os.MkdirAll(startsDir, 0755))
+	log.Noticef("Tours of the %d starts written to `%s`", r.NStarts, startsDir)
+	var wg sync.WaitGroup
+	results := make([]startResult, r.NStarts)
+	for i := range results {
+		opt := *r
+		opt.Seed = r.Seed + int64(i)
+		results[i].seed = opt.Seed
+		results[i].tourfile = path.Join(startsDir, fmt.Sprintf("seed%d.tour", opt.Seed))
+		run := func(i int, opt Optimizer) {
+			banner(fmt.Sprintf("Start %d/%d (seed = %d)", i+1, r.NStarts, opt.Seed))
+			results[i].clm, results[i].score = opt.optimize(results[i].tourfile, resumeFile)
+		}
+		if r.Parallel {
+			wg.Add(1)
+			go func(i int, opt Optimizer) {
+				defer wg.Done()
+				run(i, opt)
+			}(i, opt)
+		} else {
+			run(i, opt)
+		}
+	}
+	wg.Wait()
+
+	// Lower score is better, ties go to the earlier seed
+	best := 0
+	for i, res := range results {
+		log.Noticef("Start %d (seed = %d): score = %.5f", i+1, res.seed, -res.score)
+		if res.score < results[best].score {
+			best = i
+		}
+	}
+	log.Noticef("Best tour from seed %d copied to `%s`", results[best].seed, tourfile)
+	history, err := ioutil.ReadFile(results[best].tourfile)
+	ErrorAbort(err)
+	ErrorAbort(ioutil.WriteFile(tourfile, history, 0644))
+	orientations, err := ioutil.ReadFile(RemoveExt(results[best].tourfile) + ".orientation.txt")
+	ErrorAbort(err)
+	ErrorAbort(ioutil.WriteFile(RemoveExt(tourfile)+".orientation.txt", orientations, 0644))
+
+	tours := make([]Tour, len(results))
+	for i, res := range results {
+		tours[i] = res.clm.Tour
+	}
+	consensusFile := RemoveExt(tourfile) + ".consensus.txt"
+	writeConsensus(consensusFile, results[best].clm, tours[best], tours)
+}
+
+// adjacency is an unordered pair of tigs next to each other in a tour, regardless of
+// the orientations since a tour and its reverse are the same scaffold
+type adjacency struct {
+	a, b int
+}
+
+// adjacencyOf normalizes the pair of tigs so that a < b
+func adjacencyOf(a, b int) adjacency {
+	if a > b {
+		a, b = b, a
+	}
+	return adjacency{a, b}
+}
+
+// writeConsensus reports, for each adjacent pair of tigs in the best tour, the number
+// and fraction of tours that have the two tigs adjacent as well
+func writeConsensus(outfile string, clm *CLM, best Tour, tours []Tour) {
+	support := make(map[adjacency]int)
+	for _, tour := range tours {
+		for i := 1; i < tour.Len(); i++ {
+			support[adjacencyOf(tour.Tigs[i-1].Idx, tour.Tigs[i].Idx)]++
+		}
+	}
+
+	f, err := os.Create(outfile)
+	ErrorAbort(err)
+	w := bufio.NewWriter(f)
+	_, _ = fmt.Fprint(w, ConsensusHeader)
+	for i := 1; i < best.Len(); i++ {
+		a, b := best.Tigs[i-1], best.Tigs[i]
+		nRuns := support[adjacencyOf(a.Idx, b.Idx)]
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t%.4f\n", clm.Tigs[a.Idx].Name, clm.Tigs[b.Idx].Name,
+			nRuns, float64(nRuns)/float64(len(tours)))
+	}
+	_ = w.Flush()
+	log.Noticef("Adjacency support across %d starts written to `%s`", len(tours), outfile)
+	_ = f.Close()
+}
@@ -10,9 +10,7 @@
 package allhic
 
 import (
-	"bufio"
 	"fmt"
-	"io"
 	"math/rand"
 	"os"
 	"strings"
@@ -20,128 +18,301 @@ import (
 
 // Optimizer runs the order-and-orientation procedure, given a clmfile
 type Optimizer struct {
-	REfile    string
-	Clmfile   string
-	RunGA     bool
-	Resume    bool
-	Seed      int64
-	NPop      int
-	NGen      int
-	MutProb   float64
-	CrossProb float64
-	rng       *rand.Rand
+	REfile       string
+	Clmfile      string
+	RunGA        bool
+	Resume       bool
+	Seed         int64
+	NPop         int
+	NGen         int
+	MutProb      float64
+	CrossProb    float64
+	MinSize      int    // Tigs smaller than this are left out of the tour, 0 keeps all
+	Limit        int    // Largest distance for two tigs to add to total score
+	NContestants int    // Tournament size in GA selection
+	MaxGen       int    // Hard cap on the number of generations in GA
+	Score        string // Name of the Scorer used to evaluate tours
+	Distfile     string // Link size distribution for the likelihood score
+	Crossover    string // Name of the crossover operator used in GA
+	Method       string // Ordering optimizer, see MethodGA and the alternatives
+	NStarts      int    // Number of seeds to try, starting from Seed
+	Parallel     bool   // Run the starts in parallel
+	NIslands     int    // Number of populations evolved in parallel in GA
+	MigFrequency int    // Number of generations between migrations across islands
+	NMigrants    int    // Number of best tours sent to the next island in a migration
+	ExactSize    int    // Groups up to this size are solved exactly, 0 to skip
+	OrientInit   string // Initial orientations, see OrientEigen and OrientGW
+	OrientSearch string // Refinement of the orientations, see OrientOne and OrientKL
+	rng          *rand.Rand
 	// Output files
 	OutTourFile string
 }
 
+// setDefaults fills in the parameters that are left unset
+func (r *Optimizer) setDefaults() {
+	if r.Limit == 0 {
+		r.Limit = LIMIT
+	}
+	if r.NContestants == 0 {
+		r.NContestants = NContestants
+	}
+	if r.MaxGen == 0 {
+		r.MaxGen = MaxGen
+	}
+	if r.Score == "" {
+		r.Score = ScoreRecip
+	}
+	if r.NIslands == 0 {
+		r.NIslands = NIslands
+	}
+	if r.MigFrequency == 0 {
+		r.MigFrequency = MigFrequency
+	}
+	if r.NMigrants == 0 {
+		r.NMigrants = NMigrants
+	}
+	if r.NStarts == 0 {
+		r.NStarts = NStarts
+	}
+	if r.OrientInit == "" {
+		r.OrientInit = OrientEigen
+	}
+	if r.OrientSearch == "" {
+		r.OrientSearch = OrientOne
+	}
+	if r.Method == "" {
+		r.Method = MethodGA
+	}
+	if r.Crossover == "" {
+		r.Crossover = CrossoverOX
+	}
+	if r.Distfile == "" {
+		r.Distfile = RemoveExt(r.Clmfile) + ".distribution.txt"
+	}
+}
+
+// validate checks that the parameters make sense before we start
+func (r *Optimizer) validate() error {
+	if r.NPop < 2 {
+		return fmt.Errorf("npop must be at least 2, got %d", r.NPop)
+	}
+	if r.NGen <= 0 {
+		return fmt.Errorf("ngen must be positive, got %d", r.NGen)
+	}
+	if r.MutProb < 0 || r.MutProb > 1 {
+		return fmt.Errorf("mutation prob must be within [0, 1], got %g", r.MutProb)
+	}
+	if r.CrossProb < 0 || r.CrossProb > 1 {
+		return fmt.Errorf("crossover prob must be within [0, 1], got %g", r.CrossProb)
+	}
+	if r.ExactSize < 0 {
+		return fmt.Errorf("exactsize must not be negative, got %d", r.ExactSize)
+	}
+	if r.MinSize < 0 {
+		return fmt.Errorf("minsize must not be negative, got %d", r.MinSize)
+	}
+	if r.Limit <= 0 {
+		return fmt.Errorf("limit must be positive, got %d", r.Limit)
+	}
+	// Tournament selection picks two parents, each from a separate set of contestants
+	if r.NContestants < 1 || r.NContestants > r.NPop-1 {
+		return fmt.Errorf("ncontestants must be within [1, %d] for npop %d, got %d",
+			r.NPop-1, r.NPop, r.NContestants)
+	}
+	if r.MaxGen <= 0 {
+		return fmt.Errorf("maxgen must be positive, got %d", r.MaxGen)
+	}
+	if r.NStarts < 1 {
+		return fmt.Errorf("starts must be at least 1, got %d", r.NStarts)
+	}
+	if err := validMethod(r.Method); err != nil {
+		return err
+	}
+	if err := validOrient(r.OrientInit, r.OrientSearch); err != nil {
+		return err
+	}
+	if r.NIslands < 1 {
+		return fmt.Errorf("islands must be at least 1, got %d", r.NIslands)
+	}
+	if r.MigFrequency <= 0 {
+		return fmt.Errorf("migfreq must be positive, got %d", r.MigFrequency)
+	}
+	// Migrants replace the worst tours in the next island
+	if r.NMigrants < 1 || (r.NIslands > 1 && r.NMigrants >= r.NPop) {
+		return fmt.Errorf("migrants must be within [1, %d] for npop %d, got %d",
+			r.NPop-1, r.NPop, r.NMigrants)
+	}
+	return nil
+}
+
+// printHeader records the parameters used in this run at the top of the tour file
+func (r *Optimizer) printHeader(fwtour *os.File, scorer Scorer) {
+	_, _ = fmt.Fprintf(fwtour,
+		"#allhic %s optimize method=%s seed=%d npop=%d ngen=%d mutprob=%g crossprob=%g crossover=%s minsize=%d limit=%d ncontestants=%d maxgen=%d islands=%d migfreq=%d migrants=%d exactsize=%d orientinit=%s orientsearch=%s score=%s\n",
+		Version, r.Method, r.Seed, r.NPop, r.NGen, r.MutProb, r.CrossProb, r.Crossover, r.MinSize, r.Limit,
+		r.NContestants, r.MaxGen, r.NIslands, r.MigFrequency, r.NMigrants, r.ExactSize,
+		r.OrientInit, r.OrientSearch, scorer.Name())
+}
+
 // Run kicks off the Optimizer
 func (r *Optimizer) Run() {
-	r.rng = rand.New(rand.NewSource(r.Seed))
-	clm := NewCLM(r.Clmfile, r.REfile)
+	r.setDefaults()
+	ErrorAbort(r.validate())
 	tourfile := RemoveExt(r.REfile) + ".tour"
 
 	// Load tourfile if it exists
+	resumeFile := ""
 	if _, err := os.Stat(tourfile); r.Resume && err == nil {
 		log.Noticef("Found existing tour file `%s`", tourfile)
-		clm.parseTourFile(tourfile)
 		// Rename the tour file
-		backupTourFile := tourfile + ".sav"
-		_ = os.Rename(tourfile, backupTourFile)
-		log.Noticef("Backup `%s` to `%s`", tourfile, backupTourFile)
+		resumeFile = tourfile + ".sav"
+		_ = os.Rename(tourfile, resumeFile)
+		log.Noticef("Backup `%s` to `%s`", tourfile, resumeFile)
+	}
+
+	r.OutTourFile = tourfile
+	if r.NStarts > 1 {
+		r.multiStart(tourfile, resumeFile)
+		return
+	}
+	r.optimize(tourfile, resumeFile)
+}
+
+// optimize runs the ordering and orientation phases with the current seed, the history
+// is logged to tourfile. Returns the CLM with the final tour and its score with the
+// orientations, see evaluateOrientations, lower is better.
+func (r *Optimizer) optimize(tourfile, resumeFile string) (*CLM, float64) {
+	r.rng = rand.New(rand.NewSource(r.Seed))
+	clm := NewCLM(r.Clmfile, r.REfile)
+	scorer, err := NewScorer(r.Score, r.Distfile, clm)
+	ErrorAbort(err)
+	log.Noticef("Tours are evaluated with `%s` score", scorer.Name())
+	cross, err := NewCrossover(r.Crossover)
+	ErrorAbort(err)
+	clm.Tour.Limit = r.Limit
+	clm.Tour.Scorer = scorer
+	clm.Tour.Cross = cross
+
+	if resumeFile != "" {
+		clm.parseTourFile(resumeFile)
 	}
 
+	ErrorAbort(clm.pruneBySize(r.MinSize))
 	clm.Activate(true, r.rng)
+	if r.OrientInit == OrientGW {
+		clm.flipGW(r.rng)
+	}
 
 	// tourfile logs the intermediate configurations
 	log.Noticef("Optimization history logged to `%s`", tourfile)
 	fwtour, _ := os.Create(tourfile)
-	r.OutTourFile = tourfile
+	r.printHeader(fwtour, scorer)
 
 	clm.printTour(os.Stdout, clm.Tour, "INIT")
 	clm.printTour(fwtour, clm.Tour, "INIT")
 
 	if r.RunGA {
-		for phase := 1; phase < 3; phase++ {
-			clm.OptimizeOrdering(fwtour, r, phase)
+		// Small groups are solved exactly with the same score, instead of the heuristics
+		proven := false
+		if r.Method == MethodExact || clm.Tour.Len() <= r.ExactSize {
+			proven = clm.ExactRun(fwtour)
+		}
+		// Unless the exact method is asked for, the best tour from a search that could
+		// not be completed is refined by the ordering method
+		if !proven && r.Method != MethodExact && clm.Tour.Len() > 1 {
+			for phase := 1; phase < 3; phase++ {
+				clm.OptimizeOrdering(fwtour, r, phase)
+			}
 		}
 	}
 
-	for phase := 1; ; phase++ {
-		tag1, tag2 := clm.OptimizeOrientations(fwtour, phase)
-		if tag1 == REJECT && tag2 == REJECT {
-			log.Noticef("Terminating ... no more %v", ACCEPT)
-			break
+	// With a Scorer aware of orientations, the ordering methods already search the
+	// orientations jointly, so the separate flipping phases are not run
+	if r.RunGA && clm.Tour.oriented() {
+		log.Noticef("Orientations searched jointly with the ordering, flipping skipped")
+	} else {
+		for phase := 1; ; phase++ {
+			tag1, tag2 := clm.OptimizeOrientations(fwtour, r, phase)
+			if tag1 == REJECT && tag2 == REJECT {
+				log.Noticef("Terminating ... no more %v", ACCEPT)
+				break
+			}
 		}
 	}
 	clm.printTour(os.Stdout, clm.Tour, "FINAL")
-	log.Notice("Success")
 	_ = fwtour.Close()
+	clm.writeOrientations(RemoveExt(tourfile) + ".orientation.txt")
+	log.Notice("Success")
+
+	return clm, -clm.evaluateOrientations()
 }
 
-// OptimizeOrdering changes the ordering of contigs by Genetic Algorithm
+// OptimizeOrdering changes the ordering of contigs by Genetic Algorithm or one of the
+// alternative methods, the orientations are evolved jointly if the Scorer is aware of
+// orientations
 func (r *CLM) OptimizeOrdering(fwtour *os.File, opt *Optimizer, phase int) {
-	r.GARun(fwtour, opt, phase)
+	switch opt.Method {
+	case MethodSA:
+		r.SARun(fwtour, opt, phase)
+	case Method2Opt:
+		r.LocalSearchRun(fwtour, "2OPT", phase, Tour.twoOpt)
+	case MethodOrOpt:
+		r.LocalSearchRun(fwtour, "OROPT", phase, Tour.orOpt)
+	case MethodMemetic:
+		r.GARun(fwtour, opt, phase)
+		r.LocalSearchRun(fwtour, "LS", phase, Tour.twoOpt, Tour.orOpt)
+	default:
+		r.GARun(fwtour, opt, phase)
+	}
 	// r.pruneTour()
 }
 
 // OptimizeOrientations changes the orientations of contigs by using heuristic flipping algorithms.
-func (r *CLM) OptimizeOrientations(fwtour *os.File, phase int) (string, string) {
+func (r *CLM) OptimizeOrientations(fwtour *os.File, opt *Optimizer, phase int) (string, string) {
 	tag1 := r.flipWhole()
 	r.printTour(fwtour, r.Tour, fmt.Sprintf("FLIPWHOLE%d", phase))
+	if opt.OrientSearch == OrientKL {
+		tag2 := r.flipKL()
+		r.printTour(fwtour, r.Tour, fmt.Sprintf("FLIPKL%d", phase))
+		return tag1, tag2
+	}
 	tag2 := r.flipOne()
 	r.printTour(fwtour, r.Tour, fmt.Sprintf("FLIPONE%d", phase))
 	return tag1, tag2
 }
 
-// parseTourFile parses tour file
-// Only the last line is retained and converted into a Tour
-func parseTourFile(filename string) []string {
-	log.Noticef("Parse tour file `%s`", filename)
-	f := mustOpen(filename)
-
-	reader := bufio.NewReader(f)
-	var words []string
-	for {
-		row, err := reader.ReadString('\n')
-		row = strings.TrimSpace(row)
-		if row == "" && err == io.EOF {
-			break
-		}
-		if row[0] == '>' { // header
-			continue
-		}
-		words = strings.Split(row, " ")
-	}
-	_ = f.Close()
-	return words
-}
-
 // prepareTour prepares a boilerplate for an empty tour
 func (r *CLM) prepareTour() {
-	r.Signs = make([]byte, len(r.Tigs))
 	for _, tig := range r.Tigs {
 		tig.IsActive = false
 	}
 }
 
 // parseTourFile parses tour file
-// Only the last line is retained and converted into a Tour
+// Only the last tour is retained and converted into a Tour
 func (r *CLM) parseTourFile(filename string) {
-	words := parseTourFile(filename)
+	tf, err := ReadTourFile(filename)
+	ErrorAbort(err)
+	record, err := tf.Last()
+	ErrorAbort(err)
 	r.prepareTour()
 
 	tigs := make([]Tig, 0)
-	for _, word := range words {
-		tigName, tigOrientation := word[:len(word)-1], word[len(word)-1]
-		idx, ok := r.tigToIdx[tigName]
+	for _, c := range record.Contigs {
+		idx, ok := r.tigToIdx[c.Name]
 		if !ok {
-			log.Errorf("Contig %s not found!", tigName)
+			log.Errorf("Contig %s not found!", c.Name)
 			continue
 		}
+		sign := c.Sign
+		if sign == '?' {
+			sign = '+'
+		}
 		tigs = append(tigs, Tig{
-			Idx: idx,
+			Idx:  idx,
+			Size: r.Tigs[idx].Size,
+			Sign: sign,
 		})
-		r.Signs[idx] = tigOrientation
 		r.Tigs[idx].IsActive = true
 	}
 	r.Tour.Tigs = tigs
@@ -163,9 +334,10 @@ func (r *CLM) parseClustersFile(clustersfile string, group int) {
 			continue
 		}
 		tigs = append(tigs, Tig{
-			Idx: idx,
+			Idx:  idx,
+			Size: r.Tigs[idx].Size,
+			Sign: '+',
 		})
-		r.Signs[idx] = '+'
 		r.Tigs[idx].IsActive = true
 	}
 	r.Tour.Tigs = tigs
@@ -174,11 +346,9 @@ func (r *CLM) parseClustersFile(clustersfile string, group int) {
 
 // printTour logs the current tour to file
 func (r *CLM) printTour(fwtour *os.File, tour Tour, label string) {
-	_, _ = fwtour.WriteString(">" + label + "\n")
-	atoms := make([]string, tour.Len())
-	for i := 0; i < tour.Len(); i++ {
-		idx := tour.Tigs[i].Idx
-		atoms[i] = r.Tigs[idx].Name + string(r.Signs[idx])
+	record := TourRecord{Label: label, Contigs: make([]TourContig, tour.Len())}
+	for i, tig := range tour.Tigs {
+		record.Contigs[i] = TourContig{r.Tigs[tig.Idx].Name, tig.Sign}
 	}
-	_, _ = fwtour.WriteString(strings.Join(atoms, " ") + "\n")
+	_ = record.Write(fwtour)
 }
@@ -0,0 +1,161 @@
+/*
+ *  optimize_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/18/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// copyREfile copies the simulated group to a temporary directory, where optimize
+// writes the tour file
+func copyREfile(t *testing.T) string {
+	ids, err := ioutil.ReadFile(path.Join("tests", "simulation", "test.ids"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	refile := path.Join(t.TempDir(), "test.ids")
+	if err := ioutil.WriteFile(refile, ids, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return refile
+}
+
+// runOptimizer runs optimize on the simulated group with the given number of procs
+// and returns the content of the tour file
+func runOptimizer(t *testing.T, nprocs int) []byte {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(nprocs))
+
+	p := allhic.Optimizer{REfile: copyREfile(t),
+		Clmfile: path.Join("tests", "simulation", "test.clm"),
+		RunGA:   true, Seed: 42, NPop: 20, NGen: 50, MutProb: .2, CrossProb: .3,
+		NIslands: 2, MigFrequency: 10}
+	p.Run()
+	tour, err := ioutil.ReadFile(p.OutTourFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tour
+}
+
+func TestOptimizeReproducible(t *testing.T) {
+	expected := runOptimizer(t, 1)
+	for _, nprocs := range []int{2, 8} {
+		if got := runOptimizer(t, nprocs); !bytes.Equal(got, expected) {
+			t.Fatalf("Tour history with %d procs differs from the one with 1 proc:\n%s\nvs\n%s",
+				nprocs, got, expected)
+		}
+	}
+}
+
+func TestOptimizeMultiStart(t *testing.T) {
+	p := allhic.Optimizer{REfile: copyREfile(t),
+		Clmfile: path.Join("tests", "simulation", "test.clm"),
+		RunGA:   true, Seed: 42, NPop: 20, NGen: 50, MutProb: .2,
+		NStarts: 3, Parallel: true}
+	p.Run()
+
+	consensus, err := ioutil.ReadFile(allhic.RemoveExt(p.OutTourFile) + ".consensus.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(consensus)), "\n")
+	if lines[0]+"\n" != allhic.ConsensusHeader {
+		t.Fatalf("Unexpected header %s", lines[0])
+	}
+	// The tours of the starts are kept out of the output directory
+	for seed := 42; seed < 45; seed++ {
+		start := path.Join(allhic.RemoveExt(p.OutTourFile)+".starts", fmt.Sprintf("seed%d.tour", seed))
+		if _, err := os.Stat(start); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if matches, _ := filepath.Glob(path.Join(path.Dir(p.OutTourFile), "*seed*")); len(matches) > 0 {
+		t.Fatalf("Expected no start files next to the tour, got %v", matches)
+	}
+
+	// 100 tigs in the best tour yield 99 adjacencies
+	if len(lines)-1 != 99 {
+		t.Fatalf("Expected 99 adjacencies, got %d", len(lines)-1)
+	}
+	for _, line := range lines[1:] {
+		fields := strings.Split(line, "\t")
+		nRuns, _ := strconv.Atoi(fields[2])
+		if nRuns < 1 || nRuns > 3 {
+			t.Fatalf("Support of the best tour must be within [1, 3], got %s", line)
+		}
+	}
+}
+
+func TestOptimizeOrientationConfidence(t *testing.T) {
+	p := allhic.Optimizer{REfile: copyREfile(t),
+		Clmfile: path.Join("tests", "simulation", "test.clm"),
+		Seed:    42, NPop: 20, NGen: 50, MutProb: .2}
+	p.Run()
+
+	orientations, err := ioutil.ReadFile(allhic.RemoveExt(p.OutTourFile) + ".orientation.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(orientations)), "\n")
+	if lines[0]+"\n" != allhic.OrientationHeader {
+		t.Fatalf("Unexpected header %s", lines[0])
+	}
+	if len(lines)-1 != 100 {
+		t.Fatalf("Expected 100 contigs, got %d", len(lines)-1)
+	}
+	for _, line := range lines[1:] {
+		fields := strings.Split(line, "\t")
+		diff, _ := strconv.ParseFloat(fields[2], 64)
+		confidence, _ := strconv.ParseFloat(fields[3], 64)
+		// The final orientations come from flipOne, so no single flip improves
+		if diff < -1e-5 || confidence < .5 || confidence > 1 {
+			t.Fatalf("Unexpected orientation confidence %s", line)
+		}
+	}
+}
+
+func TestOptimizeMinSize(t *testing.T) {
+	for _, tc := range []struct {
+		minSize, expected int
+	}{{0, 100}, {10000, 94}} {
+		p := allhic.Optimizer{REfile: copyREfile(t),
+			Clmfile: path.Join("tests", "simulation", "test.clm"),
+			Seed:    42, NPop: 20, NGen: 50, MutProb: .2, MinSize: tc.minSize}
+		p.Run()
+		tf, err := allhic.ReadTourFile(p.OutTourFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		record, err := tf.Last()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(record.Contigs) != tc.expected {
+			t.Fatalf("Expected %d tigs with minsize %d, got %d", tc.expected, tc.minSize,
+				len(record.Contigs))
+		}
+	}
+
+	// Nothing is left above the largest tig
+	clm := allhic.NewCLM(path.Join("tests", "simulation", "test.clm"), copyREfile(t))
+	if err := clm.PruneBySize(2000000); err == nil {
+		t.Fatal("Expected an error with every tig pruned")
+	}
+}
@@ -10,10 +10,10 @@
 package allhic
 
 import (
+	"bufio"
 	"fmt"
 	"math"
-
-	"github.com/gonum/matrix/mat64"
+	"os"
 )
 
 // ACCEPT tag show to accept orientation flip
@@ -29,34 +29,24 @@ func flipLog(method string, score, scoreFlipped float64, tag string) {
 
 // flipAll initializes the orientations based on pairwise O matrix.
 func (r *CLM) flipAll() (tag string) {
-	var (
-		M mat64.Dense
-		e mat64.EigenSym
-	)
-
-	oldSigns := make([]byte, len(r.Signs))
-	copy(oldSigns, r.Signs)
-	score := r.EvaluateQ()
+	oldSigns := r.Tour.Signs()
+	score := r.evaluateOrientations()
 
-	N := len(r.Tigs)
-	e.Factorize(r.O(), true)
-	M.EigenvectorsSym(&e)
-	v := M.ColView(N - 1) // v is the eigenvector corresponding to the largest eigenvalue
-	// fmt.Printf("%0.2v\n\n", mat64.Formatted(v))
+	v := r.O().LeadingEigenvector() // v is the eigenvector corresponding to the largest eigenvalue
 
-	signs := make([]byte, N)
-	for i := 0; i < N; i++ {
-		if v.At(i, 0) < 0 {
+	signs := make([]byte, r.Tour.Len())
+	for i, t := range r.Tour.Tigs {
+		if v[t.Idx] < 0 {
 			signs[i] = '-'
 		} else {
 			signs[i] = '+'
 		}
 	}
-	r.Signs = signs
-	newScore := r.EvaluateQ()
+	r.Tour.SetSigns(signs)
+	newScore := r.evaluateOrientations()
 	tag = ACCEPT
 	if newScore < score {
-		copy(r.Signs, oldSigns) // Recover
+		r.Tour.SetSigns(oldSigns) // Recover
 		tag = REJECT
 	}
 	flipLog("FLIPALL", score, newScore, tag)
@@ -65,18 +55,17 @@ func (r *CLM) flipAll() (tag string) {
 
 // flipWhole test flipping all contigs at the same time to see if score improves
 func (r *CLM) flipWhole() (tag string) {
-	oldSigns := make([]byte, len(r.Signs))
-	copy(oldSigns, r.Signs)
-	score := r.EvaluateQ()
+	oldSigns := r.Tour.Signs()
+	score := r.evaluateOrientations()
 
 	// Flip all the tigs
-	for i, s := range r.Signs {
-		r.Signs[i] = rr(s)
+	for i := range r.Tour.Tigs {
+		r.Tour.Flip(i)
 	}
-	newScore := r.EvaluateQ()
+	newScore := r.evaluateOrientations()
 	tag = ACCEPT
 	if newScore <= score {
-		copy(r.Signs, oldSigns) // Recover
+		r.Tour.SetSigns(oldSigns) // Recover
 		tag = REJECT
 	}
 	flipLog("FLIPWHOLE", score, newScore, tag)
@@ -88,16 +77,15 @@ func (r *CLM) flipOne() (tag string) {
 	nAccepts := 0
 	nRejects := 0
 	anyTagACCEPT := false
-	score := r.EvaluateQ()
-	for i, t := range r.Tour.Tigs {
-		idx := t.Idx
-		r.Signs[idx] = rr(r.Signs[idx])
-		newScore := r.EvaluateQ()
+	score := r.evaluateOrientations()
+	for i := range r.Tour.Tigs {
+		r.Tour.Flip(i)
+		newScore := r.evaluateOrientations()
 		if newScore > score {
 			nAccepts++
 			tag = ACCEPT
 		} else {
-			r.Signs[idx] = rr(r.Signs[idx]) // Recover
+			r.Tour.Flip(i) // Recover
 			nRejects++
 			tag = REJECT
 		}
@@ -119,16 +107,36 @@ func (r *CLM) flipOne() (tag string) {
 	return
 }
 
+// writeOrientations reports how much each contig in the tour supports its current
+// orientation. ScoreDiff is the drop in evaluateOrientations when flipping the contig
+// alone, i.e. the difference of log likelihoods of the two orientations given the
+// orientation-specific link distances. Confidence is the posterior of the current
+// orientation with a flat prior, so that weakly oriented contigs stand out near 0.5.
+func (r *CLM) writeOrientations(outfile string) {
+	f, err := os.Create(outfile)
+	ErrorAbort(err)
+	w := bufio.NewWriter(f)
+	_, _ = fmt.Fprint(w, OrientationHeader)
+	starts := r.Tour.starts()
+	for i, t := range r.Tour.Tigs {
+		diff := -r.flipGain(starts, i)
+		confidence := 1 / (1 + math.Exp(-diff))
+		_, _ = fmt.Fprintf(w, "%s\t%c\t%.5f\t%.4f\n", r.Tigs[t.Idx].Name, t.Sign, diff, confidence)
+	}
+	_ = w.Flush()
+	log.Noticef("Orientation confidence of %d contigs written to `%s`", r.Tour.Len(), outfile)
+	_ = f.Close()
+}
+
 // O yields a pairwise orientation matrix, where each cell contains the strandedness
-// times the number of links between i-th and j-th contig
-func (r *CLM) O() *mat64.SymDense {
-	N := len(r.Tigs)
-	P := mat64.NewSymDense(N, nil)
+// times the number of links between i-th and j-th contig. Most pairs of contigs have
+// no links, so the matrix is sparse.
+func (r *CLM) O() *SparseSym {
+	entries := make(map[Pair]float64)
 	for pair, contact := range r.contacts {
-		score := float64(contact.strandedness * contact.nlinks)
-		P.SetSym(pair.ai, pair.bi, score)
+		entries[pair] = float64(contact.strandedness * contact.nlinks)
 	}
-	return P
+	return newSparseSym(len(r.Tigs), entries)
 }
 
 // Q yields a contact frequency matrix when contigs are already oriented. This is a
@@ -142,16 +150,30 @@ func (r *CLM) Q() [][]GArray {
 			P[i][j][0] = -1 // Sentinel to signal that there is no entry
 		}
 	}
+	signs := make([]byte, N) // Tigs not in the tour are left as 0 and never match
+	for _, t := range r.Tour.Tigs {
+		signs[t.Idx] = t.Sign
+	}
 	for pair, gdists := range r.orientedContacts {
 		ai := pair.ai
 		bi := pair.bi
-		if r.Signs[ai] == pair.ao && r.Signs[bi] == pair.bo {
+		if signs[ai] == pair.ao && signs[bi] == pair.bo {
 			P[ai][bi] = gdists
 		}
 	}
 	return P
 }
 
+// evaluateOrientations scores the current signs, larger is better. The Scorer of the
+// tour is used if it is aware of orientations, otherwise falls back to EvaluateQ.
+func (r *CLM) evaluateOrientations() float64 {
+	if _, ok := r.Tour.Scorer.(orientationAware); ok {
+		score, _ := r.Tour.Scorer.Score(r.Tour)
+		return -score
+	}
+	return r.EvaluateQ()
+}
+
 // EvaluateQ sums up all distance is defined as the sizes of interleaving contigs
 // plus the actual link distances. Maximize Sum(1 / distance) for all links.
 // For performance consideration, we actually use a histogram to approximate
@@ -179,7 +201,7 @@ func (r *CLM) EvaluateQ() float64 {
 				continue // Entire GArray is empty
 			}
 			dist := cumsize[j-1] - cumsize[i]
-			if dist > LIMIT {
+			if dist > tour.Limit {
 				break
 			}
 			for k := 0; k < BB; k++ {
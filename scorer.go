@@ -0,0 +1,225 @@
+/*
+ *  scorer.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/18/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// ScoreRecip sums up nlinks / dist, see Tour.EvaluateSumRecip
+	ScoreRecip = "recip"
+	// ScoreSumLog sums up nlinks * log(dist), see Tour.EvaluateSumLog
+	ScoreSumLog = "sumlog"
+	// ScoreLikelihood sums up the log link densities from the extract model
+	ScoreLikelihood = "likelihood"
+	// ScoreML sums up the log link densities of the oriented links given the gaps
+	ScoreML = "ml"
+)
+
+// Scorer is an objective function on a Tour. Since eaopt only looks at minimum,
+// a better tour always has a lower score.
+type Scorer interface {
+	Name() string
+	Score(tour Tour) (float64, error)
+}
+
+// RecipScorer scores a tour by the sum of reciprocal distances
+type RecipScorer struct{}
+
+// SumLogScorer scores a tour by the sum of log distances
+type SumLogScorer struct{}
+
+// LikelihoodScorer scores a tour by the log likelihood of the link distances under
+// the empirical LinkDensityModel written by extract
+type LikelihoodScorer struct {
+	model         *LinkDensityModel
+	logDensity    []float64 // Cached log of model.linkDensity
+	maxLogDensity []float64 // Largest logDensity from each bin onwards
+}
+
+// MLScorer scores a tour by the log likelihood of every oriented link in the .clm,
+// where the link size is the observed distance plus the gap implied by the tour
+type MLScorer struct {
+	*LikelihoodScorer
+	clm *CLM // Source of orientedContacts
+}
+
+// orientationAware is implemented by scorers that account for the contig orientations,
+// these are used in place of EvaluateQ when flipping the contigs
+type orientationAware interface {
+	orientationAware() bool
+}
+
+// NewScorer returns the Scorer with the given name, distfile is only used by the
+// likelihood scorers
+func NewScorer(name, distfile string, clm *CLM) (Scorer, error) {
+	switch name {
+	case ScoreRecip:
+		return RecipScorer{}, nil
+	case ScoreSumLog:
+		return SumLogScorer{}, nil
+	case ScoreLikelihood, ScoreML:
+		model, err := readDistribution(distfile)
+		if err != nil {
+			return nil, fmt.Errorf("score `%s` needs the link size distribution from extract: %v",
+				name, err)
+		}
+		scorer := NewLikelihoodScorer(model)
+		if name == ScoreML {
+			return &MLScorer{scorer, clm}, nil
+		}
+		return scorer, nil
+	}
+	return nil, fmt.Errorf("unknown score `%s`, choose from %s, %s, %s, %s",
+		name, ScoreRecip, ScoreSumLog, ScoreLikelihood, ScoreML)
+}
+
+// Name returns the name of the scorer
+func (r RecipScorer) Name() string {
+	return ScoreRecip
+}
+
+// Score calls Tour.EvaluateSumRecip
+func (r RecipScorer) Score(tour Tour) (float64, error) {
+	return tour.EvaluateSumRecip()
+}
+
+// Name returns the name of the scorer
+func (r SumLogScorer) Name() string {
+	return ScoreSumLog
+}
+
+// Score calls Tour.EvaluateSumLog
+func (r SumLogScorer) Score(tour Tour) (float64, error) {
+	return tour.EvaluateSumLog()
+}
+
+// NewLikelihoodScorer is the constructor for LikelihoodScorer
+func NewLikelihoodScorer(model *LinkDensityModel) *LikelihoodScorer {
+	logDensity := make([]float64, len(model.linkDensity))
+	for i, density := range model.linkDensity {
+		if density <= 0 {
+			density = model.transformPowerLaw(model.binStarts[i])
+		}
+		logDensity[i] = math.Log(density)
+	}
+	maxLogDensity := make([]float64, len(logDensity))
+	for i := len(logDensity) - 1; i >= 0; i-- {
+		maxLogDensity[i] = logDensity[i]
+		if i+1 < len(logDensity) && maxLogDensity[i+1] > maxLogDensity[i] {
+			maxLogDensity[i] = maxLogDensity[i+1]
+		}
+	}
+	return &LikelihoodScorer{model: model, logDensity: logDensity, maxLogDensity: maxLogDensity}
+}
+
+// Name returns the name of the scorer
+func (r *LikelihoodScorer) Name() string {
+	return ScoreLikelihood
+}
+
+// logProb returns the log link density at a given link size, the power law is
+// used beyond the last bin
+func (r *LikelihoodScorer) logProb(dist int) float64 {
+	bin := r.model.linkBin(dist)
+	if bin < 0 {
+		bin = 0
+	}
+	if bin >= len(r.logDensity) {
+		return math.Log(r.model.transformPowerLaw(dist))
+	}
+	return r.logDensity[bin]
+}
+
+// Score calculates the negative log likelihood of all links, taking the distance
+// between contig midpoints as the link size. Similar to EvaluateSumLog, links
+// beyond the limit are considered uninformative and contribute zero.
+func (r *LikelihoodScorer) Score(tour Tour) (float64, error) {
+	size := tour.Len()
+	mid := make([]float64, size)
+	cumSum := 0.0
+	for i, t := range tour.Tigs {
+		tsize := float64(t.Size)
+		mid[i] = cumSum + tsize/2
+		cumSum += tsize
+	}
+
+	limit := float64(tour.Limit)
+	limitLogProb := r.logProb(tour.Limit)
+	score := 0.0
+	for i := 0; i < size; i++ {
+		a := tour.Tigs[i].Idx
+		for j := i + 1; j < size; j++ {
+			b := tour.Tigs[j].Idx
+			nlinks := tour.M[a][b]
+			dist := mid[j] - mid[i]
+			if dist > limit {
+				break
+			}
+			if nlinks == 0 {
+				continue
+			}
+			score += float64(nlinks) * (limitLogProb - r.logProb(int(dist)))
+		}
+	}
+	return score, nil
+}
+
+// Name returns the name of the scorer
+func (r *MLScorer) Name() string {
+	return ScoreML
+}
+
+// orientationAware tells the flipping routines to use this scorer
+func (r *MLScorer) orientationAware() bool {
+	return true
+}
+
+// Score calculates the negative log likelihood of all oriented links. For each pair
+// of tigs in the tour, we look up the link distances given their current orientations,
+// these distances assume the two tigs are adjacent, so the gap, i.e. the sizes of all
+// interleaving tigs, is added to get the link size. Link sizes are capped at the limit
+// so that distant pairs contribute zero.
+func (r *MLScorer) Score(tour Tour) (float64, error) {
+	size := tour.Len()
+	cumsize := make([]int, size+1)
+	for i, t := range tour.Tigs {
+		cumsize[i+1] = cumsize[i] + t.Size
+	}
+
+	limitLogProb := r.logProb(tour.Limit)
+	score := 0.0
+	for i := 0; i < size; i++ {
+		ta := tour.Tigs[i]
+		for j := i + 1; j < size; j++ {
+			tb := tour.Tigs[j]
+			gap := cumsize[j] - cumsize[i+1]
+			if gap > tour.Limit {
+				break
+			}
+			if tour.M[ta.Idx][tb.Idx] == 0 {
+				continue
+			}
+			gdists, ok := r.clm.orientedContacts[OrientedPair{ta.Idx, tb.Idx, ta.Sign, tb.Sign}]
+			if !ok {
+				continue
+			}
+			for k := 0; k < BB; k++ {
+				if gdists[k] == 0 {
+					continue
+				}
+				link := min(GR[k]+gap, tour.Limit)
+				score += float64(gdists[k]) * (limitLogProb - r.logProb(link))
+			}
+		}
+	}
+	return score, nil
+}
@@ -0,0 +1,124 @@
+/*
+ *  scorer_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/18/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+func TestDistributionRoundTrip(t *testing.T) {
+	distfile := writeTestDistribution(t)
+	model, err := allhic.ReadDistribution(distfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outfile := path.Join(t.TempDir(), "copy.distribution.txt")
+	model.WriteDistribution(outfile)
+
+	expected, err := ioutil.ReadFile(distfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(outfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(expected) {
+		t.Fatalf("Expected the distribution to round-trip:\n%s\ngot\n%s", expected, got)
+	}
+	if copied, _ := allhic.ReadDistribution(outfile); copied.A != model.A || copied.B != model.B {
+		t.Fatalf("Expected power law %g * X ^ %g, got %g * X ^ %g", model.A, model.B,
+			copied.A, copied.B)
+	}
+}
+
+func TestNewScorer(t *testing.T) {
+	clm := allhic.NewCLM(path.Join("tests", "simulation", "test.clm"),
+		path.Join("tests", "simulation", "test.ids"))
+	if _, err := allhic.NewScorer("dist", "", clm); err == nil ||
+		!strings.Contains(err.Error(), "unknown score") {
+		t.Fatalf("Expected an unknown score to be rejected, got %v", err)
+	}
+	missing := path.Join(t.TempDir(), "missing.distribution.txt")
+	malformed := path.Join(t.TempDir(), "malformed.distribution.txt")
+	if err := ioutil.WriteFile(malformed, []byte(allhic.DistributionHeader+"0\t2048\tx\t1\t1\t1\n"),
+		0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, score := range []string{allhic.ScoreLikelihood, allhic.ScoreML} {
+		for _, distfile := range []string{missing, malformed} {
+			if _, err := allhic.NewScorer(score, distfile, clm); err == nil {
+				t.Fatalf("Expected score %s to need a valid distribution file, got %s", score, distfile)
+			}
+		}
+	}
+	scorer, err := allhic.NewScorer(allhic.ScoreML, writeTestDistribution(t), clm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scorer.Name() != allhic.ScoreML {
+		t.Fatalf("Expected score %s, got %s", allhic.ScoreML, scorer.Name())
+	}
+}
+
+func TestScoreInTourHeader(t *testing.T) {
+	for _, score := range []string{allhic.ScoreRecip, allhic.ScoreSumLog} {
+		p := allhic.Optimizer{REfile: copyREfile(t),
+			Clmfile: path.Join("tests", "simulation", "test.clm"),
+			Seed:    42, NPop: 20, NGen: 50, MutProb: .2, Score: score}
+		p.Run()
+		tour, err := ioutil.ReadFile(p.OutTourFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header := strings.SplitN(string(tour), "\n", 2)[0]
+		if !strings.HasPrefix(header, "#allhic") || !strings.Contains(header, " score="+score) {
+			t.Fatalf("Expected score=%s in the tour header, got %s", score, header)
+		}
+	}
+}
+
+func TestMLScorerTrueTour(t *testing.T) {
+	clm := allhic.NewCLM(path.Join("tests", "simulation", "test.clm"),
+		path.Join("tests", "simulation", "test.ids"))
+	scorer, err := allhic.NewScorer(allhic.ScoreML, writeTestDistribution(t), clm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(42))
+	clm.Tour.Limit = allhic.LIMIT
+	clm.Tour.Scorer = scorer
+	clm.Activate(false, rng)
+
+	// The simulated tigs are named in their order on the chromosome, all on + strand
+	truth := clm.Tour.Clone().(allhic.Tour)
+	for i, tig := range clm.Tigs {
+		truth.Tigs[i] = allhic.Tig{Idx: tig.Idx, Size: tig.Size, Sign: '+'}
+	}
+	truthScore, _ := scorer.Score(truth)
+
+	for k := 0; k < 10; k++ {
+		shuffled := truth.Clone().(allhic.Tour)
+		shuffled.Shuffle(rng)
+		for i := range shuffled.Tigs {
+			if rng.Intn(2) == 0 {
+				shuffled.Tigs[i].Sign = '-'
+			}
+		}
+		if score, _ := scorer.Score(shuffled); truthScore >= score {
+			t.Fatalf("Expected the true tour to score better than %.4f, got %.4f", score, truthScore)
+		}
+	}
+}
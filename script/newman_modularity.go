@@ -21,8 +21,8 @@ import (
 	"strings"
 	"sync"
 
-	"github.com/gonum/matrix/mat64"
 	logging "github.com/op/go-logging"
+	"gonum.org/v1/gonum/mat"
 )
 
 // EPS is that Q must be larger than this value
@@ -121,12 +121,12 @@ func ParseGraph(filename string) Graph {
 // NewmanSubPartition further split a partition into smaller parts
 // B* = B_ij - d_ij * Sum_k belongs to g B_ik
 // d_ij is the Kronecker delta function: d_ij = 0 when i != j, 1 otherwise
-func NewmanSubPartition(g Graph, B *mat64.SymDense, selected []int) [][]int {
+func NewmanSubPartition(g Graph, B *mat.SymDense, selected []int) [][]int {
 	var ans [][]int
 
 	n := len(selected)
 	// B*: modularity matrix for partition G only
-	Bs := mat64.NewSymDense(n, nil)
+	Bs := mat.NewSymDense(n, nil)
 	// Map the original idx to the index within this partition
 	index := make(map[int]int)
 	for i, idx := range selected {
@@ -193,7 +193,7 @@ func NewmanSubPartition(g Graph, B *mat64.SymDense, selected []int) [][]int {
 func NewmanPartition(g Graph) [][]int {
 	var ans [][]int
 
-	B := mat64.NewSymDense(g.n, nil)
+	B := mat.NewSymDense(g.n, nil)
 	k := make([]int, g.n)
 	for i := 0; i < g.n; i++ {
 		for j := 0; j < g.n; j++ {
@@ -242,7 +242,7 @@ func NewmanPartition(g Graph) [][]int {
 }
 
 // EvaluateQ calculates the Q score
-func EvaluateQ(s []int, m, n int, B *mat64.SymDense) float64 {
+func EvaluateQ(s []int, m, n int, B *mat.SymDense) float64 {
 	ans := 0.0
 	for i := 0; i < n; i++ {
 		ans += B.At(i, i)
@@ -254,7 +254,7 @@ func EvaluateQ(s []int, m, n int, B *mat64.SymDense) float64 {
 }
 
 // EvaluateDeltaQ avoids recomputing the Q score
-func EvaluateDeltaQ(s []int, m, n int, B *mat64.SymDense, i int) float64 {
+func EvaluateDeltaQ(s []int, m, n int, B *mat.SymDense, i int) float64 {
 	ans := 0.0
 	// We flip the partition of s[i]
 	for j := 0; j < n; j++ {
@@ -273,16 +273,16 @@ type Score struct {
 }
 
 // GetPartition returns score and partition s
-func GetPartition(m, n int, B *mat64.SymDense) (float64, []int) {
+func GetPartition(m, n int, B *mat.SymDense) (float64, []int) {
 	var (
-		M mat64.Dense
-		e mat64.EigenSym
+		M mat.Dense
+		e mat.EigenSym
 	)
 	// Eigen decomposition
 	e.Factorize(B, true)
-	M.EigenvectorsSym(&e)
+	e.VectorsTo(&M)
 	v := M.ColView(n - 1) // Eigenvector corresponding to the largest eigenval
-	// fmt.Printf("%0.2v\n\n", mat64.Formatted(v))
+	// fmt.Printf("%0.2v\n\n", mat.Formatted(v))
 
 	s := make([]int, n)
 	for i := 0; i < n; i++ {
@@ -299,7 +299,7 @@ func GetPartition(m, n int, B *mat64.SymDense) (float64, []int) {
 
 // RefinePartition refines partition by testing if flipping partition for each
 // contig could increase score Q. At each iteration, the largest deltaQ is selected.
-func RefinePartition(s []int, m, n int, B *mat64.SymDense) (float64, []int) {
+func RefinePartition(s []int, m, n int, B *mat.SymDense) (float64, []int) {
 	var wg sync.WaitGroup
 
 	origScore := EvaluateQ(s, m, n, B)
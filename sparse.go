@@ -0,0 +1,202 @@
+/*
+ *  sparse.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/18/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/mat"
+)
+
+const (
+	// lanczosSteps is the size of the Krylov subspace before a restart
+	lanczosSteps = 30
+	// lanczosMaxRestarts caps the number of restarts in LeadingEigenvector
+	lanczosMaxRestarts = 100
+	// lanczosTol is the residual, relative to the eigenvalue, where we stop
+	lanczosTol = 1e-10
+)
+
+// SparseSym is a symmetric matrix in compressed sparse row format. Only the nonzero
+// entries are kept, so that large groups of contigs fit in memory.
+type SparseSym struct {
+	n      int
+	rowPtr []int // Entries of row i are within [rowPtr[i], rowPtr[i+1])
+	cols   []int
+	vals   []float64
+}
+
+// newSparseSym builds a N x N symmetric matrix, the entry of each pair is copied to
+// both triangles, entries of the same cell are added up
+func newSparseSym(n int, entries map[Pair]float64) *SparseSym {
+	cells := make(map[Pair]float64)
+	for pair, v := range entries {
+		cells[pair] += v
+		if pair.ai != pair.bi {
+			cells[Pair{pair.bi, pair.ai}] += v
+		}
+	}
+	keys := make([]Pair, 0, len(cells))
+	for pair := range cells {
+		keys = append(keys, pair)
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		if keys[a].ai != keys[b].ai {
+			return keys[a].ai < keys[b].ai
+		}
+		return keys[a].bi < keys[b].bi
+	})
+
+	r := &SparseSym{n: n, rowPtr: make([]int, n+1),
+		cols: make([]int, len(keys)), vals: make([]float64, len(keys))}
+	for k, pair := range keys {
+		r.rowPtr[pair.ai+1]++
+		r.cols[k] = pair.bi
+		r.vals[k] = cells[pair]
+	}
+	for i := 0; i < n; i++ {
+		r.rowPtr[i+1] += r.rowPtr[i]
+	}
+	return r
+}
+
+// Dims returns the dimensions of the matrix, part of mat.Matrix
+func (r *SparseSym) Dims() (int, int) {
+	return r.n, r.n
+}
+
+// At returns the entry at row i and column j, part of mat.Matrix
+func (r *SparseSym) At(i, j int) float64 {
+	row := r.cols[r.rowPtr[i]:r.rowPtr[i+1]]
+	k := sort.SearchInts(row, j)
+	if k < len(row) && row[k] == j {
+		return r.vals[r.rowPtr[i]+k]
+	}
+	return 0
+}
+
+// T returns the transpose, which is the matrix itself, part of mat.Matrix
+func (r *SparseSym) T() mat.Matrix {
+	return r
+}
+
+// Symmetric returns the size of the matrix, part of mat.Symmetric
+func (r *SparseSym) Symmetric() int {
+	return r.n
+}
+
+// row returns the columns and the values of the nonzero entries in row i
+func (r *SparseSym) row(i int) ([]int, []float64) {
+	return r.cols[r.rowPtr[i]:r.rowPtr[i+1]], r.vals[r.rowPtr[i]:r.rowPtr[i+1]]
+}
+
+// mulVec computes dst = A x
+func (r *SparseSym) mulVec(dst, x []float64) {
+	for i := 0; i < r.n; i++ {
+		cols, vals := r.row(i)
+		sum := 0.0
+		for k, j := range cols {
+			sum += vals[k] * x[j]
+		}
+		dst[i] = sum
+	}
+}
+
+// LeadingEigenvector returns the unit eigenvector of the largest eigenvalue, by
+// Lanczos iterations with full reorthogonalization. The small tridiagonal problem is
+// solved with mat.EigenSym, and the Lanczos is restarted from the Ritz vector until
+// the residual is small enough.
+func (r *SparseSym) LeadingEigenvector() []float64 {
+	n := r.n
+	if n == 0 {
+		return nil
+	}
+	m := min(lanczosSteps, n)
+	// A fixed start, so that the signs are reproducible
+	rng := rand.New(rand.NewSource(Seed))
+	q := make([]float64, n)
+	for i := range q {
+		q[i] = 1 + rng.Float64()
+	}
+	floats.Scale(1/floats.Norm(q, 2), q)
+
+	for restart := 0; ; restart++ {
+		Q := [][]float64{q}
+		var alpha, beta []float64
+		for j := 0; j < m; j++ {
+			w := make([]float64, n)
+			r.mulVec(w, Q[j])
+			alpha = append(alpha, floats.Dot(w, Q[j]))
+			// Twice is enough to keep the basis orthogonal
+			for pass := 0; pass < 2; pass++ {
+				for _, qk := range Q {
+					floats.AddScaled(w, -floats.Dot(w, qk), qk)
+				}
+			}
+			b := floats.Norm(w, 2)
+			beta = append(beta, b)
+			if j == m-1 || b <= lanczosTol*math.Max(1, math.Abs(alpha[j])) {
+				break
+			}
+			floats.Scale(1/b, w)
+			Q = append(Q, w)
+		}
+
+		k := len(alpha)
+		T := mat.NewSymDense(k, nil)
+		for j := 0; j < k; j++ {
+			T.SetSym(j, j, alpha[j])
+			if j+1 < k {
+				T.SetSym(j, j+1, beta[j])
+			}
+		}
+		var (
+			e mat.EigenSym
+			S mat.Dense
+		)
+		e.Factorize(T, true)
+		theta := e.Values(nil)[k-1] // Values are in ascending order
+		e.VectorsTo(&S)
+		y := make([]float64, n)
+		for j := 0; j < k; j++ {
+			floats.AddScaled(y, S.At(j, k-1), Q[j])
+		}
+		floats.Scale(1/floats.Norm(y, 2), y)
+
+		// k < m means that the Krylov subspace is invariant and theta is exact
+		residual := math.Abs(beta[k-1] * S.At(k-1, k-1))
+		if k < m || residual <= lanczosTol*math.Max(1, math.Abs(theta)) ||
+			restart == lanczosMaxRestarts {
+			normalizeSign(y)
+			return y
+		}
+		q = y
+	}
+}
+
+// normalizeSign flips the eigenvector so that its entries sum up to a positive value,
+// or if they sum up to 0, so that its first non-zero entry is positive. The sign of
+// an eigenvector is arbitrary, this convention keeps it from depending on the solver.
+func normalizeSign(v []float64) {
+	sum := floats.Sum(v)
+	if sum == 0 {
+		for _, x := range v {
+			if x != 0 {
+				sum = x
+				break
+			}
+		}
+	}
+	if sum < 0 {
+		floats.Scale(-1, v)
+	}
+}
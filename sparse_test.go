@@ -0,0 +1,62 @@
+/*
+ *  sparse_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/18/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"math"
+	"path"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestLeadingEigenvector(t *testing.T) {
+	clm := allhic.NewCLM(path.Join("tests", "simulation", "test.clm"),
+		path.Join("tests", "simulation", "test.ids"))
+	O := clm.O()
+	n := O.Symmetric()
+
+	// Dense decomposition as the reference
+	var (
+		e mat.EigenSym
+		M mat.Dense
+	)
+	if !e.Factorize(O, true) {
+		t.Fatal("Eigen decomposition failed")
+	}
+	e.VectorsTo(&M)
+	expected := M.ColView(n - 1)
+
+	got := O.LeadingEigenvector()
+	// The eigenvector is oriented so that its entries sum up to a positive value
+	sum := 0.0
+	for _, x := range got {
+		sum += x
+	}
+	if sum <= 0 {
+		t.Fatalf("Expected a positive sum of the entries, got %.6f", sum)
+	}
+
+	// The dense decomposition with the same sign convention
+	if mat.Sum(expected) < 0 {
+		var flipped mat.VecDense
+		flipped.ScaleVec(-1, expected)
+		expected = &flipped
+	}
+	for i := 0; i < n; i++ {
+		if math.Abs(got[i]-expected.AtVec(i)) > 1e-6 {
+			t.Fatalf("Entry %d: expected %.6f, got %.6f", i, expected.AtVec(i), got[i])
+		}
+		if (got[i] < 0) != (expected.AtVec(i) < 0) {
+			t.Fatalf("Entry %d has a different sign: expected %.6f, got %.6f",
+				i, expected.AtVec(i), got[i])
+		}
+	}
+}
@@ -0,0 +1,198 @@
+/*
+ *  tourfile.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/18/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// A tour file logs the iterations of optimize, each one as a label line followed by
+// the contigs with their orientations. Comment lines record the parameters.
+//
+// #allhic optimize ...
+// >INIT
+// contig1+ contig2- contig3?
+
+// TourContig is a contig in a tour, Sign is '+', '-' or '?' if the orientation is unknown
+type TourContig struct {
+	Name string
+	Sign byte
+}
+
+// TourRecord is one iteration in a tour file
+type TourRecord struct {
+	Label   string
+	Contigs []TourContig
+}
+
+// TourFile contains all the iterations in a tour file, in the order of the file
+type TourFile struct {
+	Comments []string // Comment lines without the leading #
+	Records  []TourRecord
+}
+
+// parseTourContig splits the orientation from the contig name, names without one
+// are kept whole with an unknown orientation
+func parseTourContig(word string) TourContig {
+	sign := word[len(word)-1]
+	if len(word) > 1 && (sign == '+' || sign == '-' || sign == '?') {
+		return TourContig{word[:len(word)-1], sign}
+	}
+	return TourContig{word, '?'}
+}
+
+// ParseTour reads all the iterations from a tour file. Blank lines are skipped, and a
+// line of contigs without a label line before it gets an empty label.
+func ParseTour(reader io.Reader) (*TourFile, error) {
+	tf := new(TourFile)
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024*1024) // Tours of large groups are long lines
+	label, pending := "", false
+	for scanner.Scan() {
+		row := strings.TrimSpace(scanner.Text())
+		switch {
+		case row == "":
+			continue
+		case row[0] == '#':
+			tf.Comments = append(tf.Comments, row[1:])
+		case row[0] == '>':
+			if pending { // Label of an empty tour
+				tf.Records = append(tf.Records, TourRecord{Label: label})
+			}
+			label, pending = strings.TrimSpace(row[1:]), true
+		default:
+			words := strings.Fields(row)
+			record := TourRecord{Label: label, Contigs: make([]TourContig, len(words))}
+			for i, word := range words {
+				record.Contigs[i] = parseTourContig(word)
+			}
+			tf.Records = append(tf.Records, record)
+			label, pending = "", false
+		}
+	}
+	if pending {
+		tf.Records = append(tf.Records, TourRecord{Label: label})
+	}
+	return tf, scanner.Err()
+}
+
+// ReadTourFile parses the tour file
+func ReadTourFile(filename string) (*TourFile, error) {
+	log.Noticef("Parse tour file `%s`", filename)
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseTour(f)
+}
+
+// Last returns the last iteration, which is the final tour
+func (r *TourFile) Last() (TourRecord, error) {
+	if len(r.Records) == 0 {
+		return TourRecord{}, errors.New("no tour found")
+	}
+	return r.Records[len(r.Records)-1], nil
+}
+
+// Validate checks that every tour only has contigs listed in the counts_RE file, each
+// at most once and with a valid orientation
+func (r *TourFile) Validate(refile string) error {
+	names, err := readREContigs(refile)
+	if err != nil {
+		return err
+	}
+	for i, record := range r.Records {
+		if err := record.validate(names); err != nil {
+			return fmt.Errorf("tour %d (%s): %v", i+1, record.Label, err)
+		}
+	}
+	return nil
+}
+
+// validate checks the contigs of one tour against the names of all contigs
+func (r TourRecord) validate(names map[string]bool) error {
+	seen := make(map[string]bool)
+	for _, c := range r.Contigs {
+		if !names[c.Name] {
+			return fmt.Errorf("contig %s not found", c.Name)
+		}
+		if seen[c.Name] {
+			return fmt.Errorf("contig %s appears more than once", c.Name)
+		}
+		if c.Sign != '+' && c.Sign != '-' && c.Sign != '?' {
+			return fmt.Errorf("contig %s has invalid orientation %c", c.Name, c.Sign)
+		}
+		seen[c.Name] = true
+	}
+	return nil
+}
+
+// readREContigs collects the contig names in a counts_RE file
+func readREContigs(refile string) (map[string]bool, error) {
+	f, err := os.Open(refile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	names := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 || words[0][0] == '#' {
+			continue
+		}
+		names[words[0]] = true
+	}
+	return names, scanner.Err()
+}
+
+// Write writes the tour as a label line and a line of contigs
+func (r TourRecord) Write(w io.Writer) error {
+	atoms := make([]string, len(r.Contigs))
+	for i, c := range r.Contigs {
+		atoms[i] = c.Name + string(c.Sign)
+	}
+	_, err := fmt.Fprintf(w, ">%s\n%s\n", r.Label, strings.Join(atoms, " "))
+	return err
+}
+
+// Write writes the comments and then all the iterations, ParseTour reads them back
+func (r *TourFile) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, comment := range r.Comments {
+		if _, err := fmt.Fprintf(bw, "#%s\n", comment); err != nil {
+			return err
+		}
+	}
+	for _, record := range r.Records {
+		if err := record.Write(bw); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteFile writes the tour file to disk
+func (r *TourFile) WriteFile(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := r.Write(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,87 @@
+/*
+ *  tourfile_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/18/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"bytes"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+const testTour = `#allhic optimize seed=42
+
+>INIT
+tig0001+ tig0002- tig0003
+>EMPTY
+>GA1-1-0.5
+tig0003? tig0001- tig0002+
+
+tig0002+ tig0001+
+`
+
+func TestParseTour(t *testing.T) {
+	tf, err := allhic.ParseTour(strings.NewReader(testTour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &allhic.TourFile{
+		Comments: []string{"allhic optimize seed=42"},
+		Records: []allhic.TourRecord{
+			{Label: "INIT", Contigs: []allhic.TourContig{{"tig0001", '+'}, {"tig0002", '-'}, {"tig0003", '?'}}},
+			{Label: "EMPTY", Contigs: nil},
+			{Label: "GA1-1-0.5", Contigs: []allhic.TourContig{{"tig0003", '?'}, {"tig0001", '-'}, {"tig0002", '+'}}},
+			{Label: "", Contigs: []allhic.TourContig{{"tig0002", '+'}, {"tig0001", '+'}}},
+		},
+	}
+	if !reflect.DeepEqual(tf, expected) {
+		t.Fatalf("Expected %v, got %v", expected, tf)
+	}
+	last, err := tf.Last()
+	if err != nil || !reflect.DeepEqual(last, expected.Records[3]) {
+		t.Fatalf("Unexpected last tour %v (%v)", last, err)
+	}
+
+	// Writing and parsing again gives the same tours
+	var buf bytes.Buffer
+	if err := tf.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	again, err := allhic.ParseTour(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again, tf) {
+		t.Fatalf("Round trip changed the tours:\n%v\nvs\n%v", again, tf)
+	}
+
+	if _, err := (&allhic.TourFile{}).Last(); err == nil {
+		t.Fatal("Expected an error without any tour")
+	}
+}
+
+func TestValidateTour(t *testing.T) {
+	refile := path.Join("tests", "simulation", "test.ids")
+	for tour, valid := range map[string]bool{
+		">A\ntig0001+ tig0002-\n":         true,
+		">A\ntig0001+ tig9999-\n":         false, // Not in the counts_RE file
+		">A\ntig0001+ tig0002- tig0001\n": false, // Duplicated contig
+	} {
+		tf, err := allhic.ParseTour(strings.NewReader(tour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tf.Validate(refile); (err == nil) != valid {
+			t.Fatalf("Validation of %q: expected valid=%v, got %v", tour, valid, err)
+		}
+	}
+}